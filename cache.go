@@ -0,0 +1,596 @@
+package krest
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStorage describes the storage used by the caching middleware
+// for saving and loading cached responses.
+//
+// Implementations must be safe for concurrent use.
+type CacheStorage interface {
+	Get(key string) (entry CacheEntry, found bool, err error)
+	Set(key string, entry CacheEntry) error
+	Delete(key string) error
+}
+
+// CacheEntry describes a response saved by the caching middleware
+type CacheEntry struct {
+	StatusCode int
+	Headers    http.Header
+	Body       []byte
+
+	// VaryHeaders contains the values of the request headers listed
+	// on the `Vary` header of the response when it was stored.
+	VaryHeaders map[string]string
+
+	// The times when the request was sent and when the response
+	// was received, used for calculating the age of the entry.
+	RequestTime  time.Time
+	ResponseTime time.Time
+}
+
+// CacheConfig describes the configurations of the caching middleware
+type CacheConfig struct {
+	// Storage is where the responses are saved,
+	// if nil it defaults to `krest.NewMemoryCache(0)`
+	Storage CacheStorage
+
+	// MaxBodyBytes is the size of the largest body that will be cached, larger
+	// responses are still returned but never stored. This also applies to the
+	// Stream option, whose bodies are only buffered up to this size.
+	//
+	// If 0 it defaults to 1MiB, and negative values disable the limit.
+	MaxBodyBytes int64
+}
+
+// defaultMaxCacheBodyBytes is the default value of CacheConfig.MaxBodyBytes
+const defaultMaxCacheBodyBytes = 1024 * 1024
+
+// NewCacheMiddleware returns a middleware that caches responses for
+// GET and HEAD requests following the rules of RFC 9111 for private caches.
+//
+// Fresh responses are served directly from the storage and stale
+// responses are revalidated using `If-None-Match` and `If-Modified-Since`,
+// in which case a `304 Not Modified` response is converted back into the
+// cached response.
+//
+// Successful requests with unsafe methods (e.g. POST or DELETE)
+// invalidate any responses cached for the same URL.
+func NewCacheMiddleware(config CacheConfig) Middleware {
+	return newCacheMiddleware(config, time.Now)
+}
+
+func newCacheMiddleware(config CacheConfig, now func() time.Time) Middleware {
+	storage := config.Storage
+	if storage == nil {
+		storage = NewMemoryCache(0)
+	}
+
+	maxBodyBytes := config.MaxBodyBytes
+	if maxBodyBytes == 0 {
+		maxBodyBytes = defaultMaxCacheBodyBytes
+	}
+
+	return func(
+		ctx context.Context,
+		method string,
+		url string,
+		data RequestData,
+		next NextMiddleware,
+	) (Response, error) {
+		method = strings.ToUpper(method)
+		if method != "GET" && method != "HEAD" {
+			resp, err := next(ctx, method, url, data)
+			if err == nil && method != "OPTIONS" {
+				err = errors.Join(
+					storage.Delete(cacheKey("GET", url)),
+					storage.Delete(cacheKey("HEAD", url)),
+				)
+				if err != nil {
+					err = fmt.Errorf("error invalidating cached responses for %s: %w", url, err)
+				}
+			}
+			return resp, err
+		}
+
+		reqDirectives := parseCacheControl(getHeader(data.Headers, "Cache-Control"))
+		if _, noStore := reqDirectives["no-store"]; noStore {
+			return next(ctx, method, url, data)
+		}
+
+		key := cacheKey(method, url)
+		entry, found, err := storage.Get(key)
+		if err != nil {
+			return Response{}, fmt.Errorf("error reading response from cache: %w", err)
+		}
+		if found && !entry.matchesVary(data.Headers) {
+			found = false
+		}
+
+		if found && entry.isFresh(now(), reqDirectives) {
+			return entry.toResponse(now(), data.Stream), nil
+		}
+
+		nextData := data
+		if found {
+			nextData.Headers = copyHeaders(data.Headers)
+			if etag := entry.Headers.Get("ETag"); etag != "" {
+				setHeader(nextData.Headers, "If-None-Match", etag)
+			}
+			if lastModified := entry.Headers.Get("Last-Modified"); lastModified != "" {
+				setHeader(nextData.Headers, "If-Modified-Since", lastModified)
+			}
+		}
+
+		requestTime := now()
+		resp, err := next(ctx, method, url, nextData)
+		responseTime := now()
+
+		if found && resp.StatusCode == http.StatusNotModified {
+			entry.updateHeaders(resp.Headers)
+			entry.RequestTime = requestTime
+			entry.ResponseTime = responseTime
+			err = storage.Set(key, entry)
+			if err != nil {
+				return Response{}, fmt.Errorf("error updating cached response: %w", err)
+			}
+			return entry.toResponse(now(), data.Stream), nil
+		}
+
+		if err != nil || !isCacheable(resp, reqDirectives) {
+			return resp, err
+		}
+
+		if maxBodyBytes > 0 {
+			contentLength, parseErr := strconv.ParseInt(resp.Headers.Get("Content-Length"), 10, 64)
+			if parseErr == nil && contentLength > maxBodyBytes {
+				return resp, nil
+			}
+		}
+
+		newEntry := CacheEntry{
+			StatusCode:   resp.StatusCode,
+			Headers:      resp.Headers.Clone(),
+			VaryHeaders:  varyValues(resp.Headers, data.Headers),
+			RequestTime:  requestTime,
+			ResponseTime: responseTime,
+		}
+
+		if data.Stream {
+			// The body will only be available after the caller reads it,
+			// so we save it once the stream reaches io.EOF:
+			resp.ReadCloser = &cachingReadCloser{
+				ReadCloser: resp.ReadCloser,
+				limit:      maxBodyBytes,
+				save: func(body []byte) error {
+					newEntry.Body = body
+					return storage.Set(key, newEntry)
+				},
+			}
+			return resp, nil
+		}
+
+		if maxBodyBytes > 0 && int64(len(resp.Body)) > maxBodyBytes {
+			return resp, nil
+		}
+
+		newEntry.Body = resp.Body
+		err = storage.Set(key, newEntry)
+		if err != nil {
+			return resp, fmt.Errorf("error saving response to cache: %w", err)
+		}
+
+		return resp, nil
+	}
+}
+
+func cacheKey(method string, url string) string {
+	return method + " " + url
+}
+
+// cacheableStatus lists the status codes that can be cached,
+// since krest returns errors for any status outside the 2xx range
+// only the successful ones that are cacheable by default are listed here.
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+}
+
+func isCacheable(resp Response, reqDirectives map[string]string) bool {
+	if !cacheableStatus[resp.StatusCode] {
+		return false
+	}
+
+	respDirectives := parseCacheControl(resp.Headers.Get("Cache-Control"))
+	if _, noStore := respDirectives["no-store"]; noStore {
+		return false
+	}
+
+	if resp.Headers.Get("Vary") == "*" {
+		return false
+	}
+
+	// Only store responses that are useful to us, i.e. the ones
+	// that are either fresh for a while or that can be revalidated:
+	_, hasMaxAge := respDirectives["max-age"]
+	return hasMaxAge ||
+		resp.Headers.Get("Expires") != "" ||
+		resp.Headers.Get("ETag") != "" ||
+		resp.Headers.Get("Last-Modified") != ""
+}
+
+func varyValues(respHeaders http.Header, reqHeaders map[string]any) map[string]string {
+	values := map[string]string{}
+	for _, name := range splitHeaderList(respHeaders.Values("Vary")) {
+		values[http.CanonicalHeaderKey(name)] = getHeader(reqHeaders, name)
+	}
+	return values
+}
+
+func (e CacheEntry) matchesVary(reqHeaders map[string]any) bool {
+	for _, name := range splitHeaderList(e.Headers.Values("Vary")) {
+		if name == "*" {
+			return false
+		}
+		if e.VaryHeaders[http.CanonicalHeaderKey(name)] != getHeader(reqHeaders, name) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e CacheEntry) isFresh(now time.Time, reqDirectives map[string]string) bool {
+	respDirectives := parseCacheControl(e.Headers.Get("Cache-Control"))
+	if _, noCache := respDirectives["no-cache"]; noCache {
+		return false
+	}
+	if _, noCache := reqDirectives["no-cache"]; noCache {
+		return false
+	}
+
+	lifetime := e.freshnessLifetime(respDirectives)
+	age := e.currentAge(now)
+
+	if maxAge, ok := parseSeconds(reqDirectives, "max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := parseSeconds(reqDirectives, "min-fresh"); ok && lifetime-age < minFresh {
+		return false
+	}
+
+	return lifetime > age
+}
+
+// freshnessLifetime follows the rules described on RFC 9111 section 4.2.1
+func (e CacheEntry) freshnessLifetime(respDirectives map[string]string) time.Duration {
+	if _, ok := respDirectives["max-age"]; ok {
+		maxAge, _ := parseSeconds(respDirectives, "max-age")
+		return maxAge
+	}
+
+	if expires := e.Headers.Get("Expires"); expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			// Invalid dates must be treated as already expired:
+			return 0
+		}
+		return expiresAt.Sub(e.date())
+	}
+
+	// Heuristic freshness as suggested on RFC 9111 section 4.2.2:
+	if lastModified, err := http.ParseTime(e.Headers.Get("Last-Modified")); err == nil {
+		return e.date().Sub(lastModified) / 10
+	}
+
+	return 0
+}
+
+// currentAge follows the rules described on RFC 9111 section 4.2.3
+func (e CacheEntry) currentAge(now time.Time) time.Duration {
+	apparentAge := e.ResponseTime.Sub(e.date())
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+
+	ageValue, _ := strconv.Atoi(e.Headers.Get("Age"))
+	responseDelay := e.ResponseTime.Sub(e.RequestTime)
+	correctedAgeValue := time.Duration(ageValue)*time.Second + responseDelay
+
+	correctedInitialAge := apparentAge
+	if correctedAgeValue > correctedInitialAge {
+		correctedInitialAge = correctedAgeValue
+	}
+
+	return correctedInitialAge + now.Sub(e.ResponseTime)
+}
+
+func (e CacheEntry) date() time.Time {
+	date, err := http.ParseTime(e.Headers.Get("Date"))
+	if err != nil {
+		return e.ResponseTime
+	}
+	return date
+}
+
+// updateHeaders freshens the stored headers using the
+// headers received on a `304 Not Modified` response.
+func (e *CacheEntry) updateHeaders(headers http.Header) {
+	for k, v := range headers {
+		if k == "Content-Length" {
+			continue
+		}
+		e.Headers[k] = v
+	}
+}
+
+func (e CacheEntry) toResponse(now time.Time, stream bool) Response {
+	headers := e.Headers.Clone()
+	headers.Set("Age", strconv.Itoa(int(e.currentAge(now).Seconds())))
+
+	body := append([]byte(nil), e.Body...)
+	resp := Response{
+		ReadCloser: io.NopCloser(bytes.NewReader(body)),
+		Headers:    headers,
+		StatusCode: e.StatusCode,
+	}
+	if !stream {
+		resp.Body = body
+	}
+	return resp
+}
+
+func parseCacheControl(header string) map[string]string {
+	directives := map[string]string{}
+	for _, directive := range splitHeaderList([]string{header}) {
+		name, value := directive, ""
+		if i := strings.Index(directive, "="); i >= 0 {
+			name, value = directive[:i], strings.Trim(directive[i+1:], `"`)
+		}
+		directives[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return directives
+}
+
+func parseSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	secs, err := strconv.Atoi(directives[name])
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+func splitHeaderList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// cachingReadCloser saves the body once the stream reaches io.EOF,
+// unless it is larger than the limit, in which case it stops
+// buffering the body and the response is not cached.
+type cachingReadCloser struct {
+	io.ReadCloser
+
+	buf   bytes.Buffer
+	limit int64
+	save  func(body []byte) error
+	saved bool
+}
+
+// Read implements the io.Reader interface
+func (c *cachingReadCloser) Read(p []byte) (n int, err error) {
+	n, err = c.ReadCloser.Read(p)
+	if !c.saved {
+		if c.limit > 0 && int64(c.buf.Len()+n) > c.limit {
+			// Marking it as saved skips the caching of this response:
+			c.saved = true
+			c.buf = bytes.Buffer{}
+		} else {
+			c.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !c.saved {
+		c.saved = true
+		saveErr := c.save(c.buf.Bytes())
+		if saveErr != nil {
+			return n, fmt.Errorf("error saving response to cache: %w", saveErr)
+		}
+	}
+	return n, err
+}
+
+// MemoryCache is an in-memory CacheStorage that evicts
+// the least recently used entries when it is full.
+type MemoryCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry CacheEntry
+}
+
+// NewMemoryCache instantiates a new MemoryCache that holds
+// at most `maxEntries` responses, if 0 it defaults to 1000.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	if maxEntries == 0 {
+		maxEntries = 1000
+	}
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+// Get implements the CacheStorage interface
+func (m *MemoryCache) Get(key string) (CacheEntry, bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	elem, found := m.entries[key]
+	if !found {
+		return CacheEntry{}, false, nil
+	}
+	m.lru.MoveToFront(elem)
+
+	return copyCacheEntry(elem.Value.(*memoryCacheItem).entry), true, nil
+}
+
+// Set implements the CacheStorage interface
+func (m *MemoryCache) Set(key string, entry CacheEntry) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry = copyCacheEntry(entry)
+	if elem, found := m.entries[key]; found {
+		elem.Value.(*memoryCacheItem).entry = entry
+		m.lru.MoveToFront(elem)
+		return nil
+	}
+
+	m.entries[key] = m.lru.PushFront(&memoryCacheItem{
+		key:   key,
+		entry: entry,
+	})
+
+	for m.lru.Len() > m.maxEntries {
+		oldest := m.lru.Back()
+		m.lru.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+
+	return nil
+}
+
+// Delete implements the CacheStorage interface
+func (m *MemoryCache) Delete(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if elem, found := m.entries[key]; found {
+		m.lru.Remove(elem)
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+func copyCacheEntry(entry CacheEntry) CacheEntry {
+	entry.Headers = entry.Headers.Clone()
+	entry.Body = append([]byte(nil), entry.Body...)
+
+	varyHeaders := make(map[string]string, len(entry.VaryHeaders))
+	for k, v := range entry.VaryHeaders {
+		varyHeaders[k] = v
+	}
+	entry.VaryHeaders = varyHeaders
+
+	return entry
+}
+
+// DiskCache is a CacheStorage that saves each entry
+// as a JSON file inside a directory.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache instantiates a new DiskCache creating
+// the input directory if it doesn't exist yet.
+func NewDiskCache(dir string) (DiskCache, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return DiskCache{}, fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	return DiskCache{
+		dir: dir,
+	}, nil
+}
+
+// Get implements the CacheStorage interface
+func (d DiskCache) Get(key string) (CacheEntry, bool, error) {
+	content, err := os.ReadFile(d.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return CacheEntry{}, false, nil
+	}
+	if err != nil {
+		return CacheEntry{}, false, err
+	}
+
+	var entry CacheEntry
+	err = json.Unmarshal(content, &entry)
+	if err != nil {
+		return CacheEntry{}, false, fmt.Errorf("error decoding cache entry for key '%s': %w", key, err)
+	}
+
+	return entry, true, nil
+}
+
+// Set implements the CacheStorage interface
+func (d DiskCache) Set(key string, entry CacheEntry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so concurrent
+	// readers never see a partially written entry:
+	tmpFile, err := os.CreateTemp(d.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmpFile.Write(content)
+	err = errors.Join(err, tmpFile.Close())
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), d.path(key))
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+
+	return nil
+}
+
+// Delete implements the CacheStorage interface
+func (d DiskCache) Delete(key string) error {
+	err := os.Remove(d.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (d DiskCache) path(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(hash[:]))
+}
@@ -0,0 +1,338 @@
+package krest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestCacheMiddleware(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should serve fresh responses from the cache", func(t *testing.T) {
+		var numRequests int
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			numRequests++
+			w.Header().Set("Cache-Control", "max-age=60")
+			_, _ = fmt.Fprintf(w, "response %d", numRequests)
+		}))
+		defer svr.Close()
+
+		client := New(time.Second, NewCacheMiddleware(CacheConfig{}))
+
+		resp, err := client.Get(ctx, svr.URL, RequestData{})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, string(resp.Body), "response 1")
+
+		resp, err = client.Get(ctx, svr.URL, RequestData{})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, string(resp.Body), "response 1")
+		tt.AssertEqual(t, resp.StatusCode, 200)
+		tt.AssertEqual(t, numRequests, 1)
+	})
+
+	t.Run("should revalidate stale responses using the ETag", func(t *testing.T) {
+		var ifNoneMatch []string
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+			// Omit the Date header so the age is computed using the fake clock:
+			w.Header()["Date"] = nil
+			w.Header().Set("Cache-Control", "max-age=10")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			_, _ = fmt.Fprint(w, "fakeBody")
+		}))
+		defer svr.Close()
+
+		now := time.Now()
+		middleware := newCacheMiddleware(CacheConfig{}, func() time.Time { return now })
+		client := New(time.Second, middleware)
+
+		_, err := client.Get(ctx, svr.URL, RequestData{})
+		tt.AssertNoErr(t, err)
+
+		now = now.Add(20 * time.Second)
+		resp, err := client.Get(ctx, svr.URL, RequestData{})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, resp.StatusCode, 200)
+		tt.AssertEqual(t, string(resp.Body), "fakeBody")
+
+		// The 304 must have freshened the entry:
+		now = now.Add(5 * time.Second)
+		_, err = client.Get(ctx, svr.URL, RequestData{})
+		tt.AssertNoErr(t, err)
+
+		tt.AssertEqual(t, ifNoneMatch, []string{"", `"v1"`})
+	})
+
+	t.Run("should revalidate using Last-Modified when there is no ETag", func(t *testing.T) {
+		lastModified := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+
+		var ifModifiedSince []string
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ifModifiedSince = append(ifModifiedSince, r.Header.Get("If-Modified-Since"))
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Last-Modified", lastModified)
+			if r.Header.Get("If-Modified-Since") != "" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			_, _ = fmt.Fprint(w, "fakeBody")
+		}))
+		defer svr.Close()
+
+		client := New(time.Second, NewCacheMiddleware(CacheConfig{}))
+
+		for i := 0; i < 2; i++ {
+			resp, err := client.Get(ctx, svr.URL, RequestData{})
+			tt.AssertNoErr(t, err)
+			tt.AssertEqual(t, string(resp.Body), "fakeBody")
+		}
+
+		tt.AssertEqual(t, ifModifiedSince, []string{"", lastModified})
+	})
+
+	t.Run("should respect the Vary header", func(t *testing.T) {
+		var numRequests int
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			numRequests++
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+			_, _ = fmt.Fprint(w, r.Header.Get("Accept-Language"))
+		}))
+		defer svr.Close()
+
+		client := New(time.Second, NewCacheMiddleware(CacheConfig{}))
+
+		for _, lang := range []string{"en", "en", "pt", "pt"} {
+			resp, err := client.Get(ctx, svr.URL, RequestData{
+				Headers: map[string]any{
+					"accept-language": lang,
+				},
+			})
+			tt.AssertNoErr(t, err)
+			tt.AssertEqual(t, string(resp.Body), lang)
+		}
+
+		tt.AssertEqual(t, numRequests, 2)
+	})
+
+	t.Run("should not store responses with no-store", func(t *testing.T) {
+		var numRequests int
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			numRequests++
+			w.Header().Set("Cache-Control", "max-age=60, no-store")
+		}))
+		defer svr.Close()
+
+		client := New(time.Second, NewCacheMiddleware(CacheConfig{}))
+
+		for i := 0; i < 2; i++ {
+			_, err := client.Get(ctx, svr.URL, RequestData{})
+			tt.AssertNoErr(t, err)
+		}
+
+		tt.AssertEqual(t, numRequests, 2)
+	})
+
+	t.Run("should expire responses using the Expires header", func(t *testing.T) {
+		var numRequests int
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			numRequests++
+			w.Header().Set("Expires", time.Now().Add(10*time.Second).UTC().Format(http.TimeFormat))
+		}))
+		defer svr.Close()
+
+		now := time.Now()
+		middleware := newCacheMiddleware(CacheConfig{}, func() time.Time { return now })
+		client := New(time.Second, middleware)
+
+		_, err := client.Get(ctx, svr.URL, RequestData{})
+		tt.AssertNoErr(t, err)
+		_, err = client.Get(ctx, svr.URL, RequestData{})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, numRequests, 1)
+
+		now = now.Add(15 * time.Second)
+		_, err = client.Get(ctx, svr.URL, RequestData{})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, numRequests, 2)
+	})
+
+	t.Run("should invalidate cached responses after unsafe requests", func(t *testing.T) {
+		var numRequests int
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			numRequests++
+			w.Header().Set("Cache-Control", "max-age=60")
+		}))
+		defer svr.Close()
+
+		client := New(time.Second, NewCacheMiddleware(CacheConfig{}))
+
+		_, err := client.Get(ctx, svr.URL, RequestData{})
+		tt.AssertNoErr(t, err)
+		_, err = client.Post(ctx, svr.URL, RequestData{})
+		tt.AssertNoErr(t, err)
+		_, err = client.Get(ctx, svr.URL, RequestData{})
+		tt.AssertNoErr(t, err)
+
+		tt.AssertEqual(t, numRequests, 3)
+	})
+
+	t.Run("should work with the Stream option", func(t *testing.T) {
+		var numRequests int
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			numRequests++
+			w.Header().Set("Cache-Control", "max-age=60")
+			_, _ = fmt.Fprint(w, "fakeStreamedBody")
+		}))
+		defer svr.Close()
+
+		client := New(time.Second, NewCacheMiddleware(CacheConfig{}))
+
+		for i := 0; i < 2; i++ {
+			resp, err := client.Get(ctx, svr.URL, RequestData{
+				Stream: true,
+			})
+			tt.AssertNoErr(t, err)
+			tt.AssertEqual(t, resp.Body, []byte(nil))
+
+			body, err := io.ReadAll(resp)
+			tt.AssertNoErr(t, err)
+			tt.AssertNoErr(t, resp.Close())
+			tt.AssertEqual(t, string(body), "fakeStreamedBody")
+		}
+
+		tt.AssertEqual(t, numRequests, 1)
+	})
+}
+
+func TestCacheMaxBodyBytes(t *testing.T) {
+	ctx := context.Background()
+
+	largeBody := strings.Repeat("0123456789", 100)
+
+	for _, test := range []struct {
+		desc          string
+		stream        bool
+		contentLength bool
+	}{
+		{
+			desc:          "buffered response",
+			contentLength: true,
+		},
+		{
+			desc:          "streamed response with Content-Length",
+			stream:        true,
+			contentLength: true,
+		},
+		{
+			desc:   "streamed response without Content-Length",
+			stream: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var numRequests int
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				numRequests++
+				w.Header().Set("Cache-Control", "max-age=60")
+				if test.contentLength {
+					w.Header().Set("Content-Length", strconv.Itoa(len(largeBody)))
+				}
+				_, _ = io.WriteString(w, largeBody)
+				w.(http.Flusher).Flush()
+			}))
+			defer svr.Close()
+
+			storage := NewMemoryCache(0)
+			client := New(time.Second, NewCacheMiddleware(CacheConfig{
+				Storage:      storage,
+				MaxBodyBytes: 100,
+			}))
+
+			for i := 0; i < 2; i++ {
+				resp, err := client.Get(ctx, svr.URL, RequestData{
+					Stream: test.stream,
+				})
+				tt.AssertNoErr(t, err)
+
+				body := resp.Body
+				if test.stream {
+					body, err = io.ReadAll(resp)
+					tt.AssertNoErr(t, err)
+					tt.AssertNoErr(t, resp.Close())
+				}
+				tt.AssertEqual(t, string(body), largeBody)
+			}
+
+			tt.AssertEqual(t, numRequests, 2)
+			tt.AssertEqual(t, storage.lru.Len(), 0)
+		})
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	t.Run("should evict the least recently used entries", func(t *testing.T) {
+		cache := NewMemoryCache(2)
+
+		tt.AssertNoErr(t, cache.Set("key1", CacheEntry{Body: []byte("1")}))
+		tt.AssertNoErr(t, cache.Set("key2", CacheEntry{Body: []byte("2")}))
+
+		// Mark key1 as recently used:
+		_, found, err := cache.Get("key1")
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, found, true)
+
+		tt.AssertNoErr(t, cache.Set("key3", CacheEntry{Body: []byte("3")}))
+
+		_, found, _ = cache.Get("key2")
+		tt.AssertEqual(t, found, false)
+
+		entry, found, _ := cache.Get("key1")
+		tt.AssertEqual(t, found, true)
+		tt.AssertEqual(t, string(entry.Body), "1")
+	})
+}
+
+func TestDiskCache(t *testing.T) {
+	t.Run("should save, load and delete entries", func(t *testing.T) {
+		cache, err := NewDiskCache(t.TempDir())
+		tt.AssertNoErr(t, err)
+
+		responseTime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+		entry := CacheEntry{
+			StatusCode: 200,
+			Headers: http.Header{
+				"Etag": []string{`"fakeETag"`},
+			},
+			Body: []byte("fakeBody"),
+			VaryHeaders: map[string]string{
+				"Accept": "application/json",
+			},
+			RequestTime:  responseTime,
+			ResponseTime: responseTime,
+		}
+		tt.AssertNoErr(t, cache.Set("fakeKey", entry))
+
+		got, found, err := cache.Get("fakeKey")
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, found, true)
+		tt.AssertEqual(t, got, entry)
+
+		tt.AssertNoErr(t, cache.Delete("fakeKey"))
+		_, found, err = cache.Get("fakeKey")
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, found, false)
+	})
+}
@@ -0,0 +1,141 @@
+package krest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+// Codec describes how request and response bodies of
+// a given content type are encoded and decoded.
+type Codec interface {
+	// ContentType returns the media type handled by this codec, e.g. "application/json"
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encodes and decodes bodies using the encoding/json package,
+// it is the default codec for encoding request bodies.
+type JSONCodec struct{}
+
+// ContentType implements the Codec interface
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+// Marshal implements the Codec interface
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements the Codec interface
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// XMLCodec encodes and decodes bodies using the encoding/xml package
+type XMLCodec struct{}
+
+// ContentType implements the Codec interface
+func (XMLCodec) ContentType() string {
+	return "application/xml"
+}
+
+// Marshal implements the Codec interface
+func (XMLCodec) Marshal(v interface{}) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+// Unmarshal implements the Codec interface
+func (XMLCodec) Unmarshal(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+var defaultCodecs = []Codec{JSONCodec{}, XMLCodec{}}
+
+// RegisterCodecs adds one or more codecs to this instance, these are used
+// for decoding responses based on their `Content-Type` header.
+//
+// The JSON and XML codecs are registered by default, and codecs registered
+// later take precedence over the previous ones for the same content type.
+func (c *Client) RegisterCodecs(codecs ...Codec) {
+	if c.codecs == nil {
+		c.codecs = append([]Codec{}, defaultCodecs...)
+	}
+	c.codecs = append(c.codecs, codecs...)
+}
+
+// Decode unmarshals the response body into the value pointed by v
+// using the codec registered for the response `Content-Type`.
+//
+// If the response has no `Content-Type` it is decoded as JSON.
+//
+// When used with the Stream option the body is read and closed.
+func (r Response) Decode(v interface{}) error {
+	codec, err := findCodec(r.codecs, r.Headers.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+
+	body := r.Body
+	if body == nil && r.ReadCloser != nil {
+		body, err = io.ReadAll(r.ReadCloser)
+		if closeErr := r.ReadCloser.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("error reading response body: %w", err)
+		}
+	}
+
+	err = codec.Unmarshal(body, v)
+	if err != nil {
+		return fmt.Errorf("error decoding response body as %s: %w", codec.ContentType(), err)
+	}
+
+	return nil
+}
+
+// findCodec chooses the codec for the input content type, matching
+// structured syntax suffixes as well, e.g. "application/vnd.api+json"
+// is decoded by the "application/json" codec.
+func findCodec(codecs []Codec, contentType string) (Codec, error) {
+	if codecs == nil {
+		codecs = defaultCodecs
+	}
+
+	if contentType == "" {
+		return JSONCodec{}, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Type '%s': %w", contentType, err)
+	}
+
+	var suffixMatch Codec
+	for i := len(codecs) - 1; i >= 0; i-- {
+		codecType := codecs[i].ContentType()
+		if mediaType == codecType {
+			return codecs[i], nil
+		}
+
+		subtype := codecType[strings.Index(codecType, "/")+1:]
+		if suffixMatch == nil && strings.HasSuffix(mediaType, "+"+subtype) {
+			suffixMatch = codecs[i]
+		}
+	}
+
+	if suffixMatch == nil && mediaType == "text/xml" {
+		return findCodec(codecs, "application/xml")
+	}
+	if suffixMatch == nil {
+		return nil, fmt.Errorf("no codec registered for Content-Type '%s'", mediaType)
+	}
+
+	return suffixMatch, nil
+}
@@ -0,0 +1,175 @@
+package krest
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+type fakeCSVCodec struct{}
+
+func (fakeCSVCodec) ContentType() string {
+	return "text/csv"
+}
+
+func (fakeCSVCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(strings.Join(v.([]string), ",")), nil
+}
+
+func (fakeCSVCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]string) = strings.Split(string(data), ",")
+	return nil
+}
+
+func TestCodecs(t *testing.T) {
+	ctx := context.Background()
+
+	type user struct {
+		XMLName xml.Name `xml:"user" json:"-"`
+		Name    string   `xml:"name" json:"name"`
+	}
+
+	t.Run("should encode the body using the request codec", func(t *testing.T) {
+		for _, test := range []struct {
+			desc                string
+			codec               Codec
+			body                interface{}
+			expectedBody        string
+			expectedContentType string
+		}{
+			{
+				desc:                "default JSON codec",
+				body:                user{Name: "fakeName"},
+				expectedBody:        `{"name":"fakeName"}`,
+				expectedContentType: "application/json",
+			},
+			{
+				desc:                "XML codec",
+				codec:               XMLCodec{},
+				body:                user{Name: "fakeName"},
+				expectedBody:        `<user><name>fakeName</name></user>`,
+				expectedContentType: "application/xml",
+			},
+			{
+				desc:                "custom codec",
+				codec:               fakeCSVCodec{},
+				body:                []string{"a", "b"},
+				expectedBody:        `a,b`,
+				expectedContentType: "text/csv",
+			},
+		} {
+			t.Run(test.desc, func(t *testing.T) {
+				var requestBody []byte
+				var contentType string
+				svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					requestBody, _ = io.ReadAll(r.Body)
+					contentType = r.Header.Get("Content-Type")
+				}))
+				defer svr.Close()
+
+				client := New(time.Second)
+				_, err := client.Post(ctx, svr.URL, RequestData{
+					Codec: test.codec,
+					Body:  test.body,
+				})
+				tt.AssertNoErr(t, err)
+				tt.AssertEqual(t, string(requestBody), test.expectedBody)
+				tt.AssertEqual(t, contentType, test.expectedContentType)
+			})
+		}
+	})
+
+	t.Run("should decode the response using its Content-Type", func(t *testing.T) {
+		for _, test := range []struct {
+			desc        string
+			contentType string
+			body        string
+			stream      bool
+
+			expectedName       string
+			expectErrToContain []string
+		}{
+			{
+				desc:         "JSON",
+				contentType:  "application/json; charset=utf-8",
+				body:         `{"name":"fakeName"}`,
+				expectedName: "fakeName",
+			},
+			{
+				desc:         "JSON with structured syntax suffix",
+				contentType:  "application/vnd.api+json",
+				body:         `{"name":"fakeName"}`,
+				expectedName: "fakeName",
+			},
+			{
+				desc:         "XML",
+				contentType:  "text/xml",
+				body:         `<user><name>fakeName</name></user>`,
+				expectedName: "fakeName",
+			},
+			{
+				desc:         "JSON with the Stream option",
+				contentType:  "application/json",
+				body:         `{"name":"fakeName"}`,
+				stream:       true,
+				expectedName: "fakeName",
+			},
+			{
+				desc:               "unknown content type",
+				contentType:        "application/unknown",
+				body:               `fakeBody`,
+				expectErrToContain: []string{"no codec", "application/unknown"},
+			},
+		} {
+			t.Run(test.desc, func(t *testing.T) {
+				svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", test.contentType)
+					_, _ = fmt.Fprint(w, test.body)
+				}))
+				defer svr.Close()
+
+				client := New(time.Second)
+				resp, err := client.Get(ctx, svr.URL, RequestData{
+					Stream: test.stream,
+				})
+				tt.AssertNoErr(t, err)
+
+				var u user
+				err = resp.Decode(&u)
+				if test.expectErrToContain != nil {
+					tt.AssertErrContains(t, err, test.expectErrToContain...)
+					return
+				}
+				tt.AssertNoErr(t, err)
+				tt.AssertEqual(t, u.Name, test.expectedName)
+			})
+		}
+	})
+
+	t.Run("should decode responses using registered codecs", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/csv")
+			_, _ = fmt.Fprint(w, "a,b,c")
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		client.RegisterCodecs(fakeCSVCodec{})
+
+		resp, err := client.Get(ctx, svr.URL, RequestData{})
+		tt.AssertNoErr(t, err)
+
+		var values []string
+		err = resp.Decode(&values)
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, values, []string{"a", "b", "c"})
+	})
+}
@@ -0,0 +1,28 @@
+// Package kcbor provides a krest.Codec for encoding
+// and decoding bodies using CBOR (RFC 8949).
+package kcbor
+
+import (
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vingarcia/krest"
+)
+
+// Codec implements the krest.Codec interface using CBOR
+type Codec struct{}
+
+var _ krest.Codec = Codec{}
+
+// ContentType implements the krest.Codec interface
+func (Codec) ContentType() string {
+	return "application/cbor"
+}
+
+// Marshal implements the krest.Codec interface
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+// Unmarshal implements the krest.Codec interface
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return cbor.Unmarshal(data, v)
+}
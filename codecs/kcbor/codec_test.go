@@ -0,0 +1,25 @@
+package kcbor
+
+import (
+	"testing"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestCodec(t *testing.T) {
+	t.Run("should encode and decode values", func(t *testing.T) {
+		type user struct {
+			Name string `json:"name"`
+			Age  int    `json:"age"`
+		}
+
+		payload, err := Codec{}.Marshal(user{Name: "fakeName", Age: 42})
+		tt.AssertNoErr(t, err)
+
+		var decoded user
+		err = Codec{}.Unmarshal(payload, &decoded)
+		tt.AssertNoErr(t, err)
+
+		tt.AssertEqual(t, decoded, user{Name: "fakeName", Age: 42})
+	})
+}
@@ -0,0 +1,28 @@
+// Package kmsgpack provides a krest.Codec for encoding
+// and decoding bodies using MessagePack.
+package kmsgpack
+
+import (
+	"github.com/vingarcia/krest"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec implements the krest.Codec interface using MessagePack
+type Codec struct{}
+
+var _ krest.Codec = Codec{}
+
+// ContentType implements the krest.Codec interface
+func (Codec) ContentType() string {
+	return "application/msgpack"
+}
+
+// Marshal implements the krest.Codec interface
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// Unmarshal implements the krest.Codec interface
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
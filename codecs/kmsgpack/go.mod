@@ -0,0 +1,16 @@
+module github.com/vingarcia/krest/codecs/kmsgpack
+
+go 1.20
+
+require (
+	github.com/vingarcia/krest v0.0.0-20261018122351-0d2bf5b212e2
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stretchr/testify v1.8.4 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
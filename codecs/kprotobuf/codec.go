@@ -0,0 +1,39 @@
+// Package kprotobuf provides a krest.Codec for encoding
+// and decoding bodies using Protocol Buffers.
+package kprotobuf
+
+import (
+	"fmt"
+
+	"github.com/vingarcia/krest"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec implements the krest.Codec interface using Protocol Buffers,
+// it only accepts values that implement the proto.Message interface.
+type Codec struct{}
+
+var _ krest.Codec = Codec{}
+
+// ContentType implements the krest.Codec interface
+func (Codec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+// Marshal implements the krest.Codec interface
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("kprotobuf: expected a proto.Message but got: %T", v)
+	}
+	return proto.Marshal(msg)
+}
+
+// Unmarshal implements the krest.Codec interface
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("kprotobuf: expected a proto.Message but got: %T", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
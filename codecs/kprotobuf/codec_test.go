@@ -0,0 +1,26 @@
+package kprotobuf
+
+import (
+	"testing"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCodec(t *testing.T) {
+	t.Run("should encode and decode proto messages", func(t *testing.T) {
+		payload, err := Codec{}.Marshal(wrapperspb.String("fakeValue"))
+		tt.AssertNoErr(t, err)
+
+		var decoded wrapperspb.StringValue
+		err = Codec{}.Unmarshal(payload, &decoded)
+		tt.AssertNoErr(t, err)
+
+		tt.AssertEqual(t, decoded.GetValue(), "fakeValue")
+	})
+
+	t.Run("should reject values that are not proto messages", func(t *testing.T) {
+		_, err := Codec{}.Marshal(map[string]string{"fake": "value"})
+		tt.AssertNotEqual(t, err, nil)
+	})
+}
@@ -0,0 +1,15 @@
+module github.com/vingarcia/krest/codecs/kprotobuf
+
+go 1.20
+
+require (
+	github.com/vingarcia/krest v0.0.0-20261018122351-0d2bf5b212e2
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stretchr/testify v1.8.4 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
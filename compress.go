@@ -0,0 +1,171 @@
+package krest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// defaultCompressMinSize is the default value for RequestData.CompressMinSize
+const defaultCompressMinSize = 1024
+
+// Compressor describes how request bodies are compressed
+// for a given content coding, e.g. "gzip" or "zstd".
+type Compressor interface {
+	// ContentEncoding returns the value sent on the `Content-Encoding` header
+	ContentEncoding() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+}
+
+// GzipCompressor compresses request bodies using the compress/gzip package
+type GzipCompressor struct {
+	// Level is the compression level as defined on the
+	// compress/gzip package, if 0 it defaults to gzip.DefaultCompression
+	Level int
+}
+
+// ContentEncoding implements the Compressor interface
+func (GzipCompressor) ContentEncoding() string {
+	return "gzip"
+}
+
+// NewWriter implements the Compressor interface
+func (g GzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	level := g.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+// DeflateCompressor compresses request bodies using the zlib format,
+// which is what the "deflate" content coding stands for on HTTP.
+type DeflateCompressor struct {
+	// Level is the compression level as defined on the
+	// compress/zlib package, if 0 it defaults to zlib.DefaultCompression
+	Level int
+}
+
+// ContentEncoding implements the Compressor interface
+func (DeflateCompressor) ContentEncoding() string {
+	return "deflate"
+}
+
+// NewWriter implements the Compressor interface
+func (d DeflateCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	level := d.Level
+	if level == 0 {
+		level = zlib.DefaultCompression
+	}
+	return zlib.NewWriterLevel(w, level)
+}
+
+// shouldCompress checks if the request body should be compressed,
+// which is not the case if the caller already set the `Content-Encoding`.
+func shouldCompress(data *RequestData) bool {
+	return data.CompressBody != nil && getHeader(data.Headers, "Content-Encoding") == ""
+}
+
+// compressPayload compresses a buffered request body and sets the
+// `Content-Encoding` header, bodies smaller than RequestData.CompressMinSize
+// are returned without changes.
+func compressPayload(data *RequestData, payload []byte) ([]byte, error) {
+	minSize := data.CompressMinSize
+	if minSize == 0 {
+		minSize = defaultCompressMinSize
+	}
+	if !shouldCompress(data) || len(payload) == 0 || len(payload) < minSize {
+		return payload, nil
+	}
+
+	var buf bytes.Buffer
+	w, err := data.CompressBody.NewWriter(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("error compressing request body: %w", err)
+	}
+	_, err = w.Write(payload)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error compressing request body: %w", err)
+	}
+
+	data.Headers = copyHeaders(data.Headers)
+	setHeader(data.Headers, "Content-Encoding", data.CompressBody.ContentEncoding())
+
+	return buf.Bytes(), nil
+}
+
+// compressingReader compresses a streamed request body as it is read,
+// without the use of goroutines so nothing leaks if the request is aborted.
+type compressingReader struct {
+	source io.Reader
+	writer io.WriteCloser
+	buf    *bytes.Buffer
+	chunk  []byte
+	done   bool
+}
+
+func newCompressingReader(compressor Compressor, source io.Reader) (*compressingReader, error) {
+	buf := &bytes.Buffer{}
+	writer, err := compressor.NewWriter(buf)
+	if err != nil {
+		return nil, fmt.Errorf("error compressing request body: %w", err)
+	}
+
+	return &compressingReader{
+		source: source,
+		writer: writer,
+		buf:    buf,
+		chunk:  make([]byte, 32*1024),
+	}, nil
+}
+
+// Read implements the io.Reader interface
+func (c *compressingReader) Read(p []byte) (int, error) {
+	for c.buf.Len() == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+
+		n, err := c.source.Read(c.chunk)
+		if n > 0 {
+			_, writeErr := c.writer.Write(c.chunk[:n])
+			if writeErr != nil {
+				return 0, fmt.Errorf("error compressing request body: %w", writeErr)
+			}
+		}
+
+		if err == io.EOF {
+			c.done = true
+			err = c.writer.Close()
+			if err != nil {
+				return 0, fmt.Errorf("error compressing request body: %w", err)
+			}
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	return c.buf.Read(p)
+}
+
+// Close implements the io.Closer interface, closing the
+// source as well if it is an io.Closer, e.g. a multipart
+// stream with an open file or a body given by the caller.
+func (c *compressingReader) Close() error {
+	var err error
+	if !c.done {
+		c.done = true
+		err = c.writer.Close()
+	}
+
+	if closer, ok := c.source.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
@@ -0,0 +1,203 @@
+package krest
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestRequestCompression(t *testing.T) {
+	ctx := context.Background()
+
+	largeBody := strings.Repeat("fakeData", 200)
+
+	for _, test := range []struct {
+		desc       string
+		body       interface{}
+		compressor Compressor
+		minSize    int
+		headers    map[string]any
+		maxRetries int
+
+		expectedEncoding string
+		expectedBody     string
+	}{
+		{
+			desc:             "should compress large bodies with gzip",
+			body:             largeBody,
+			compressor:       GzipCompressor{},
+			expectedEncoding: "gzip",
+			expectedBody:     largeBody,
+		},
+		{
+			desc:             "should compress large bodies with deflate",
+			body:             []byte(largeBody),
+			compressor:       DeflateCompressor{},
+			expectedEncoding: "deflate",
+			expectedBody:     largeBody,
+		},
+		{
+			desc:             "should compress marshaled bodies",
+			body:             map[string]string{"data": largeBody},
+			compressor:       GzipCompressor{},
+			expectedEncoding: "gzip",
+			expectedBody:     `{"data":"` + largeBody + `"}`,
+		},
+		{
+			desc:         "should not compress bodies smaller than the threshold",
+			body:         "fakeSmallBody",
+			compressor:   GzipCompressor{},
+			expectedBody: "fakeSmallBody",
+		},
+		{
+			desc:             "should respect a custom threshold",
+			body:             "fakeSmallBody",
+			compressor:       GzipCompressor{},
+			minSize:          5,
+			expectedEncoding: "gzip",
+			expectedBody:     "fakeSmallBody",
+		},
+		{
+			desc:             "should compress streamed bodies regardless of the threshold",
+			body:             strings.NewReader("fakeSmallBody"),
+			compressor:       GzipCompressor{},
+			expectedEncoding: "gzip",
+			expectedBody:     "fakeSmallBody",
+		},
+		{
+			desc:       "should not compress if the Content-Encoding was already set",
+			body:       largeBody,
+			compressor: GzipCompressor{},
+			headers: map[string]any{
+				"content-encoding": "identity",
+			},
+			expectedEncoding: "identity",
+			expectedBody:     largeBody,
+		},
+		{
+			desc:             "should replay compressed bodies on retries",
+			body:             largeBody,
+			compressor:       GzipCompressor{},
+			maxRetries:       2,
+			expectedEncoding: "gzip",
+			expectedBody:     largeBody,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var requests int
+			var encoding string
+			var receivedBody string
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				encoding = r.Header.Get("Content-Encoding")
+
+				var reader io.Reader = r.Body
+				switch encoding {
+				case "gzip":
+					reader, _ = gzip.NewReader(r.Body)
+				case "deflate":
+					reader, _ = zlib.NewReader(r.Body)
+				}
+				body, _ := io.ReadAll(reader)
+				receivedBody = string(body)
+
+				if requests < test.maxRetries {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer svr.Close()
+
+			client := New(time.Second)
+			_, err := client.Post(ctx, svr.URL, RequestData{
+				Headers:         test.headers,
+				Body:            test.body,
+				CompressBody:    test.compressor,
+				CompressMinSize: test.minSize,
+				MaxRetries:      test.maxRetries,
+				BaseRetryDelay:  time.Millisecond,
+			})
+			tt.AssertNoErr(t, err)
+
+			tt.AssertEqual(t, encoding, test.expectedEncoding)
+			tt.AssertEqual(t, receivedBody, test.expectedBody)
+		})
+	}
+
+	t.Run("should compute the Content-Digest over the compressed body", func(t *testing.T) {
+		var digest string
+		var expectedDigest string
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			digest = r.Header.Get("Content-Digest")
+			body, _ := io.ReadAll(r.Body)
+			expectedDigest, _ = computeDigest(DigestSHA256, body)
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		_, err := client.Post(ctx, svr.URL, RequestData{
+			Body:          largeBody,
+			CompressBody:  GzipCompressor{},
+			ContentDigest: DigestSHA256,
+		})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, digest, expectedDigest)
+	})
+
+	t.Run("should close streamed bodies", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.ReadAll(r.Body)
+		}))
+		defer svr.Close()
+
+		body := newNotifyingReadCloser(strings.NewReader(largeBody))
+
+		client := New(time.Second)
+		_, err := client.Post(ctx, svr.URL, RequestData{
+			Body:         body,
+			CompressBody: GzipCompressor{},
+		})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, body.waitClose(time.Second), true)
+	})
+}
+
+// notifyingReadCloser allows the tests to wait until
+// the body is closed, which the transport does asynchronously.
+type notifyingReadCloser struct {
+	io.Reader
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newNotifyingReadCloser(r io.Reader) *notifyingReadCloser {
+	return &notifyingReadCloser{
+		Reader: r,
+		closed: make(chan struct{}),
+	}
+}
+
+func (n *notifyingReadCloser) Close() error {
+	n.closeOnce.Do(func() {
+		close(n.closed)
+	})
+	return nil
+}
+
+func (n *notifyingReadCloser) waitClose(timeout time.Duration) bool {
+	select {
+	case <-n.closed:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
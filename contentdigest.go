@@ -0,0 +1,231 @@
+package krest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// The digest algorithms supported by the ContentDigest option
+const (
+	DigestSHA256 = "sha-256"
+	DigestSHA512 = "sha-512"
+)
+
+// DigestMismatchError is returned when the digest of a response body
+// doesn't match the value sent by the server on the `Content-Digest`
+// or `Repr-Digest` headers.
+type DigestMismatchError struct {
+	Header    string
+	Algorithm string
+	Expected  []byte
+	Got       []byte
+}
+
+// Error implements the error interface
+func (e DigestMismatchError) Error() string {
+	return fmt.Sprintf(
+		"%s mismatch for %s: expected :%s: but got :%s:",
+		e.Header,
+		e.Algorithm,
+		base64.StdEncoding.EncodeToString(e.Expected),
+		base64.StdEncoding.EncodeToString(e.Got),
+	)
+}
+
+func newDigestHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case DigestSHA256:
+		return sha256.New(), nil
+	case DigestSHA512:
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm: '%s'", algorithm)
+	}
+}
+
+// formatDigest formats a digest as a structured field
+// dictionary member, e.g. `sha-256=:base64 value:`
+func formatDigest(algorithm string, sum []byte) string {
+	return algorithm + "=:" + base64.StdEncoding.EncodeToString(sum) + ":"
+}
+
+func computeDigest(algorithm string, payload []byte) (string, error) {
+	h, err := newDigestHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	h.Write(payload)
+	return formatDigest(algorithm, h.Sum(nil)), nil
+}
+
+// expectedDigest describes a digest received on a response header
+// that will be compared with the digest of the received body.
+type expectedDigest struct {
+	header    string
+	algorithm string
+	value     []byte
+}
+
+// parseExpectedDigests reads the `Content-Digest` and `Repr-Digest` headers
+// choosing the strongest supported algorithm on each of them.
+func parseExpectedDigests(resp *http.Response) ([]expectedDigest, error) {
+	headers := []string{"Content-Digest"}
+	if resp.StatusCode != http.StatusPartialContent {
+		// For partial responses the Repr-Digest refers to
+		// the full representation so we can't verify it:
+		headers = append(headers, "Repr-Digest")
+	}
+
+	var digests []expectedDigest
+	for _, header := range headers {
+		chosen, err := parseDigestHeader(resp.Header, header)
+		if err != nil {
+			return nil, err
+		}
+
+		if chosen != nil {
+			digests = append(digests, *chosen)
+		}
+	}
+
+	return digests, nil
+}
+
+// parseDigestHeader returns the digest with the strongest supported
+// algorithm from the input header, or nil if there is none.
+func parseDigestHeader(headers http.Header, header string) (*expectedDigest, error) {
+	values := headers.Values(header)
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	var chosen *expectedDigest
+	for _, member := range splitOutsideQuotes(strings.Join(values, ","), ',') {
+		kv := strings.SplitN(strings.TrimSpace(member), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		algorithm := strings.ToLower(kv[0])
+		if algorithm != DigestSHA256 && algorithm != DigestSHA512 {
+			continue
+		}
+		if chosen != nil && chosen.algorithm == DigestSHA512 {
+			continue
+		}
+
+		value := kv[1]
+		if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			return nil, fmt.Errorf("invalid %s header: %s", header, member)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s header: %w", header, err)
+		}
+
+		chosen = &expectedDigest{
+			header:    header,
+			algorithm: algorithm,
+			value:     decoded,
+		}
+	}
+
+	return chosen, nil
+}
+
+func verifyDigests(digests []expectedDigest, body []byte) error {
+	for _, digest := range digests {
+		h, _ := newDigestHash(digest.algorithm)
+		h.Write(body)
+		if sum := h.Sum(nil); !bytes.Equal(sum, digest.value) {
+			return DigestMismatchError{
+				Header:    digest.header,
+				Algorithm: digest.algorithm,
+				Expected:  digest.value,
+				Got:       sum,
+			}
+		}
+	}
+	return nil
+}
+
+// digestingReader computes the digest of a request body while it is
+// sent and saves it on the request trailers once it reaches io.EOF.
+type digestingReader struct {
+	reader    io.Reader
+	algorithm string
+	hash      hash.Hash
+	trailer   http.Header
+}
+
+// Read implements the io.Reader interface
+func (d *digestingReader) Read(p []byte) (n int, err error) {
+	n, err = d.reader.Read(p)
+	d.hash.Write(p[:n])
+	if err == io.EOF {
+		d.trailer.Set("Content-Digest", formatDigest(d.algorithm, d.hash.Sum(nil)))
+	}
+	return n, err
+}
+
+// Close implements the io.Closer interface, closing
+// the wrapped reader if it is an io.Closer.
+func (d *digestingReader) Close() error {
+	if closer, ok := d.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// verifyingReadCloser verifies the digests of a streamed response
+// incrementally, returning a DigestMismatchError instead of io.EOF
+// if the received body doesn't match the expected digests.
+type verifyingReadCloser struct {
+	io.ReadCloser
+
+	digests []expectedDigest
+	hashes  []hash.Hash
+}
+
+func newVerifyingReadCloser(body io.ReadCloser, digests []expectedDigest) *verifyingReadCloser {
+	hashes := make([]hash.Hash, len(digests))
+	for i, digest := range digests {
+		hashes[i], _ = newDigestHash(digest.algorithm)
+	}
+
+	return &verifyingReadCloser{
+		ReadCloser: body,
+		digests:    digests,
+		hashes:     hashes,
+	}
+}
+
+// Read implements the io.Reader interface
+func (v *verifyingReadCloser) Read(p []byte) (n int, err error) {
+	n, err = v.ReadCloser.Read(p)
+	for _, h := range v.hashes {
+		h.Write(p[:n])
+	}
+
+	if err == io.EOF {
+		for i, digest := range v.digests {
+			if sum := v.hashes[i].Sum(nil); !bytes.Equal(sum, digest.value) {
+				return n, DigestMismatchError{
+					Header:    digest.header,
+					Algorithm: digest.algorithm,
+					Expected:  digest.value,
+					Got:       sum,
+				}
+			}
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,168 @@
+package krest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestContentDigest(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should send the digest of the request body", func(t *testing.T) {
+		for _, test := range []struct {
+			desc           string
+			body           any
+			algorithm      string
+			expectedDigest string
+		}{
+			{
+				desc:           "with JSON body",
+				body:           map[string]string{"hello": "world"},
+				algorithm:      DigestSHA256,
+				expectedDigest: "sha-256=:k6I5cakU5erL8KjSUVTNownDwccvu5kU1Hxg88toFYg=:",
+			},
+			{
+				desc:           "with string body",
+				body:           `{"hello": "world"}` + "\n",
+				algorithm:      DigestSHA256,
+				expectedDigest: "sha-256=:RK/0qy18MlBSVnWgjwz6lZEWjP/lF5HF9bvEF8FabDg=:",
+			},
+			{
+				desc:      "with []byte body using sha-512",
+				body:      []byte(`{"hello": "world"}` + "\n"),
+				algorithm: DigestSHA512,
+				expectedDigest: "sha-512=:YMAam51Jz/jOATT6/zvHrLVgOYTGFy1d6GJiOHTohq4yP+pgk4vf2aCs" +
+					"yRZOtw8MjkM7iw7yZ/WkppmM44T3qg==:",
+			},
+		} {
+			t.Run(test.desc, func(t *testing.T) {
+				var digest string
+				svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					digest = r.Header.Get("Content-Digest")
+				}))
+				defer svr.Close()
+
+				client := New(time.Second)
+				_, err := client.Post(ctx, svr.URL, RequestData{
+					Body:          test.body,
+					ContentDigest: test.algorithm,
+				})
+				tt.AssertNoErr(t, err)
+				tt.AssertEqual(t, digest, test.expectedDigest)
+			})
+		}
+	})
+
+	t.Run("should send the digest of streamed bodies as a trailer", func(t *testing.T) {
+		var digest string
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.ReadAll(r.Body)
+			digest = r.Trailer.Get("Content-Digest")
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		_, err := client.Post(ctx, svr.URL, RequestData{
+			Body:          strings.NewReader(`{"hello": "world"}` + "\n"),
+			ContentDigest: DigestSHA256,
+		})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, digest, "sha-256=:RK/0qy18MlBSVnWgjwz6lZEWjP/lF5HF9bvEF8FabDg=:")
+	})
+
+	t.Run("should close streamed bodies", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.ReadAll(r.Body)
+		}))
+		defer svr.Close()
+
+		body := newNotifyingReadCloser(strings.NewReader(`{"hello": "world"}` + "\n"))
+
+		client := New(time.Second)
+		_, err := client.Post(ctx, svr.URL, RequestData{
+			Body:          body,
+			ContentDigest: DigestSHA256,
+		})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, body.waitClose(time.Second), true)
+	})
+
+	t.Run("should verify the digest of responses", func(t *testing.T) {
+		for _, test := range []struct {
+			desc           string
+			header         string
+			digest         string
+			stream         bool
+			expectMismatch bool
+		}{
+			{
+				desc:   "valid Content-Digest",
+				header: "Content-Digest",
+				digest: "sha-256=:RK/0qy18MlBSVnWgjwz6lZEWjP/lF5HF9bvEF8FabDg=:",
+			},
+			{
+				desc:   "valid Repr-Digest with unknown algorithms",
+				header: "Repr-Digest",
+				digest: "md5=:fakeValue:, sha-256=:RK/0qy18MlBSVnWgjwz6lZEWjP/lF5HF9bvEF8FabDg=:",
+			},
+			{
+				desc:           "invalid Content-Digest",
+				header:         "Content-Digest",
+				digest:         "sha-256=:AAAAqy18MlBSVnWgjwz6lZEWjP/lF5HF9bvEF8FabDg=:",
+				expectMismatch: true,
+			},
+			{
+				desc:   "valid Content-Digest with stream",
+				header: "Content-Digest",
+				digest: "sha-256=:RK/0qy18MlBSVnWgjwz6lZEWjP/lF5HF9bvEF8FabDg=:",
+				stream: true,
+			},
+			{
+				desc:           "invalid Content-Digest with stream",
+				header:         "Content-Digest",
+				digest:         "sha-256=:AAAAqy18MlBSVnWgjwz6lZEWjP/lF5HF9bvEF8FabDg=:",
+				stream:         true,
+				expectMismatch: true,
+			},
+		} {
+			t.Run(test.desc, func(t *testing.T) {
+				svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set(test.header, test.digest)
+					_, _ = fmt.Fprint(w, `{"hello": "world"}`+"\n")
+				}))
+				defer svr.Close()
+
+				client := New(time.Second)
+				resp, err := client.Get(ctx, svr.URL, RequestData{
+					VerifyResponseDigest: true,
+					Stream:               test.stream,
+				})
+				if test.stream {
+					tt.AssertNoErr(t, err)
+					_, err = io.ReadAll(resp)
+					_ = resp.Close()
+				}
+
+				if !test.expectMismatch {
+					tt.AssertNoErr(t, err)
+					return
+				}
+
+				var mismatchErr DigestMismatchError
+				tt.AssertEqual(t, errors.As(err, &mismatchErr), true)
+				tt.AssertEqual(t, mismatchErr.Header, test.header)
+				tt.AssertEqual(t, mismatchErr.Algorithm, DigestSHA256)
+				tt.AssertErrContains(t, err, "Content-Digest mismatch")
+			})
+		}
+	})
+}
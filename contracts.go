@@ -31,6 +31,14 @@ type RequestData struct {
 	// be marshaled into JSON
 	Body interface{}
 
+	// Codec selects how the Body is encoded, if nil it defaults
+	// to `krest.JSONCodec{}`, the codec also sets the `Content-Type`
+	// header of the request unless it was set on the Headers map.
+	//
+	// Bodies of type string, []byte, io.Reader, url.Values,
+	// krest.FormBody, krest.MultipartData and krest.MultipartForm are not affected by it.
+	Codec Codec
+
 	Headers map[string]any
 
 	// It's the max number of retries, if 0 it defaults 1
@@ -73,6 +81,65 @@ type RequestData struct {
 	// if you are not using the Stream option or if the call
 	// returns an error.
 	Stream bool
+
+	// ContentDigest sets the algorithm used for sending the
+	// `Content-Digest` header (RFC 9530) of the request body,
+	// it accepts `krest.DigestSHA256` and `krest.DigestSHA512`.
+	//
+	// Bodies of type io.Reader have their digest sent as
+	// a trailer since it is only known after they are sent.
+	ContentDigest string
+
+	// VerifyResponseDigest enables the verification of the
+	// `Content-Digest` and `Repr-Digest` headers of the response,
+	// returning a `krest.DigestMismatchError` if they don't match.
+	//
+	// When used with the Stream option the error is returned
+	// by resp.Read() after the whole body was read.
+	//
+	// Since the digests refer to the encoded bytes, the transparent gzip
+	// decompression of the http.Transport is disabled for these requests
+	// and the body is only decompressed by krest after it is verified.
+	VerifyResponseDigest bool
+
+	// DisableDecompression disables the transparent decompression
+	// of responses whose `Content-Encoding` is supported by the client,
+	// returning the body exactly as it was received. In this case the
+	// `Accept-Encoding` header is only sent if it is set on the Headers.
+	DisableDecompression bool
+
+	// CompressBody sets the compressor used for the request body, e.g.
+	// `krest.GzipCompressor{}`, which also sets the `Content-Encoding`
+	// header. If the header was already set the body is sent as is.
+	//
+	// Bodies of type io.Reader and multipart bodies are compressed
+	// while they are sent, regardless of the CompressMinSize option.
+	CompressBody Compressor
+
+	// CompressMinSize is the minimum size in bytes for a body to be
+	// compressed, smaller bodies are sent uncompressed, if 0 it defaults to 1024
+	CompressMinSize int
+
+	// MaxResponseBytes limits the size of the response body, if the limit
+	// is exceeded an error wrapping `krest.ErrResponseTooLarge` is returned
+	// along with the response containing the body truncated to the limit.
+	//
+	// When used with the Stream option the error is returned by resp.Read().
+	//
+	// If 0 it defaults to the limit set with client.SetMaxResponseBytes(),
+	// which by default is unlimited, and negative values disable the limit.
+	MaxResponseBytes int64
+
+	// OnProgress is called as the request body is sent and then as the
+	// response body is received, each with its own total size taken from
+	// the `Content-Length` when it is known. Empty bodies are not reported.
+	//
+	// The calls are throttled to at most one every 100ms, except for the
+	// last one of each body, and might be made from a different goroutine.
+	// For responses the sizes refer to the body as it was sent by the server,
+	// i.e. before decompression, and with the Stream option the progress is
+	// only reported as the response is read.
+	OnProgress ProgressFunc
 }
 
 // SetDefaultsIfNecessary sets the default values
@@ -103,6 +170,18 @@ type Response struct {
 	Body       []byte
 	Headers    http.Header
 	StatusCode int
+
+	// ContentEncoding is the original `Content-Encoding` of the response,
+	// it is only set when the body was transparently decompressed, in which
+	// case the `Content-Encoding` and `Content-Length` headers are removed.
+	ContentEncoding string
+
+	// codecs are the codecs registered on the client,
+	// used by the resp.Decode() method
+	codecs []Codec
+
+	// streamed is true when the body was not buffered on the Body attribute
+	streamed bool
 }
 
 // DefaultRetryRule is the default retry rule that will retry (i.e. return true)
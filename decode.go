@@ -0,0 +1,172 @@
+package krest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ResponseError is the error returned by the typed helpers, e.g. krest.GetJSON(),
+// when the response status is not in the range 200-299, it contains the
+// error payload decoded into the type chosen by the caller.
+//
+// It can be retrieved using errors.As:
+//
+//	var respErr krest.ResponseError[MyAPIError]
+//	if errors.As(err, &respErr) {
+//		fmt.Println(respErr.Body.Code)
+//	}
+type ResponseError[E any] struct {
+	Method     string
+	URL        string
+	StatusCode int
+
+	// Body is the decoded error payload, it is left
+	// empty if the payload couldn't be decoded as JSON.
+	Body E
+
+	// Err is the original error returned by the Provider
+	Err error
+}
+
+// Error implements the error interface
+func (e ResponseError[E]) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap allows errors.Is and errors.As to inspect the original error
+func (e ResponseError[E]) Unwrap() error {
+	return e.Err
+}
+
+// GetJSON makes a GET request and decodes the JSON response into a value of type T.
+//
+// On non-2xx responses a krest.ResponseError[json.RawMessage] is returned,
+// use krest.DoJSON() if you want to decode the error payload into a custom type.
+func GetJSON[T any](ctx context.Context, provider Provider, url string, data RequestData) (T, Response, error) {
+	return DoJSON[T, json.RawMessage](ctx, provider, "GET", url, data)
+}
+
+// PostJSON makes a POST request and decodes the JSON response into a value of type T,
+// see krest.GetJSON() for details.
+func PostJSON[T any](ctx context.Context, provider Provider, url string, data RequestData) (T, Response, error) {
+	return DoJSON[T, json.RawMessage](ctx, provider, "POST", url, data)
+}
+
+// PutJSON makes a PUT request and decodes the JSON response into a value of type T,
+// see krest.GetJSON() for details.
+func PutJSON[T any](ctx context.Context, provider Provider, url string, data RequestData) (T, Response, error) {
+	return DoJSON[T, json.RawMessage](ctx, provider, "PUT", url, data)
+}
+
+// PatchJSON makes a PATCH request and decodes the JSON response into a value of type T,
+// see krest.GetJSON() for details.
+func PatchJSON[T any](ctx context.Context, provider Provider, url string, data RequestData) (T, Response, error) {
+	return DoJSON[T, json.RawMessage](ctx, provider, "PATCH", url, data)
+}
+
+// DeleteJSON makes a DELETE request and decodes the JSON response into a value of type T,
+// see krest.GetJSON() for details.
+func DeleteJSON[T any](ctx context.Context, provider Provider, url string, data RequestData) (T, Response, error) {
+	return DoJSON[T, json.RawMessage](ctx, provider, "DELETE", url, data)
+}
+
+// DoJSON makes a request with the input method and decodes the JSON response
+// into a value of type T, on non-2xx responses the error payload is decoded
+// into a value of type E and returned as a krest.ResponseError[E].
+//
+// It works with both buffered and streamed responses, in the
+// latter case the response body is closed after decoding it.
+func DoJSON[T any, E any](ctx context.Context, provider Provider, method string, url string, data RequestData) (T, Response, error) {
+	var value T
+
+	resp, err := doRequest(ctx, provider, method, url, data)
+	if err != nil {
+		if resp.StatusCode == 0 {
+			return value, resp, err
+		}
+
+		respErr := ResponseError[E]{
+			Method:     strings.ToUpper(method),
+			URL:        url,
+			StatusCode: resp.StatusCode,
+			Err:        err,
+		}
+		// Ignore decoding errors, since the original error
+		// already contains the raw payload:
+		_ = json.Unmarshal(resp.Body, &respErr.Body)
+
+		return value, resp, respErr
+	}
+
+	err = resp.DecodeJSON(&value)
+	if err != nil {
+		return value, resp, fmt.Errorf("%s %s: %w", strings.ToUpper(method), url, err)
+	}
+
+	return value, resp, nil
+}
+
+func doRequest(ctx context.Context, provider Provider, method string, url string, data RequestData) (Response, error) {
+	switch strings.ToUpper(method) {
+	case "GET":
+		return provider.Get(ctx, url, data)
+	case "POST":
+		return provider.Post(ctx, url, data)
+	case "PUT":
+		return provider.Put(ctx, url, data)
+	case "PATCH":
+		return provider.Patch(ctx, url, data)
+	case "DELETE":
+		return provider.Delete(ctx, url, data)
+	case "OPTIONS":
+		return provider.Options(ctx, url, data)
+	default:
+		return Response{}, fmt.Errorf("unsupported request method: %q", method)
+	}
+}
+
+// DecodeJSON unmarshals the JSON response body into the value pointed by v.
+//
+// When used with the Stream option the body is decoded
+// directly from the stream and closed afterwards.
+//
+// Empty bodies, e.g. on 204 No Content responses,
+// leave the value pointed by v untouched.
+func (r Response) DecodeJSON(v interface{}) error {
+	if r.StatusCode == http.StatusNoContent {
+		if r.ReadCloser != nil {
+			return r.ReadCloser.Close()
+		}
+		return nil
+	}
+
+	if r.Body != nil || r.ReadCloser == nil {
+		if len(r.Body) == 0 {
+			return nil
+		}
+
+		err := json.Unmarshal(r.Body, v)
+		if err != nil {
+			return fmt.Errorf("error decoding response body as JSON: %w", err)
+		}
+		return nil
+	}
+
+	err := json.NewDecoder(r.ReadCloser).Decode(v)
+	if err == io.EOF {
+		// The stream was empty:
+		err = nil
+	}
+	if closeErr := r.ReadCloser.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error decoding response body as JSON: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package krest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestTypedDecoding(t *testing.T) {
+	ctx := context.Background()
+
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	type apiError struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+
+	t.Run("should decode successful responses", func(t *testing.T) {
+		for _, test := range []struct {
+			desc   string
+			stream bool
+		}{
+			{
+				desc: "buffered response",
+			},
+			{
+				desc:   "stream response",
+				stream: true,
+			},
+		} {
+			t.Run(test.desc, func(t *testing.T) {
+				var method string
+				svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					method = r.Method
+					_, _ = fmt.Fprint(w, `{"id":42,"name":"fakeName"}`)
+				}))
+				defer svr.Close()
+
+				client := New(time.Second)
+				u, resp, err := GetJSON[user](ctx, client, svr.URL, RequestData{
+					Stream: test.stream,
+				})
+				tt.AssertNoErr(t, err)
+				tt.AssertEqual(t, method, "GET")
+				tt.AssertEqual(t, resp.StatusCode, 200)
+				tt.AssertEqual(t, u, user{ID: 42, Name: "fakeName"})
+			})
+		}
+	})
+
+	t.Run("should use the right method for each helper", func(t *testing.T) {
+		for _, test := range []struct {
+			expectedMethod string
+			helper         func(ctx context.Context, provider Provider, url string, data RequestData) (user, Response, error)
+		}{
+			{expectedMethod: "GET", helper: GetJSON[user]},
+			{expectedMethod: "POST", helper: PostJSON[user]},
+			{expectedMethod: "PUT", helper: PutJSON[user]},
+			{expectedMethod: "PATCH", helper: PatchJSON[user]},
+			{expectedMethod: "DELETE", helper: DeleteJSON[user]},
+		} {
+			t.Run(test.expectedMethod, func(t *testing.T) {
+				var method string
+				svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					method = r.Method
+					_, _ = fmt.Fprint(w, `{"id":1}`)
+				}))
+				defer svr.Close()
+
+				u, _, err := test.helper(ctx, New(time.Second), svr.URL, RequestData{})
+				tt.AssertNoErr(t, err)
+				tt.AssertEqual(t, method, test.expectedMethod)
+				tt.AssertEqual(t, u.ID, 1)
+			})
+		}
+	})
+
+	t.Run("should decode error payloads into the error type", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"code":"not_found","message":"fakeMessage"}`)
+		}))
+		defer svr.Close()
+
+		_, resp, err := DoJSON[user, apiError](ctx, New(time.Second), "GET", svr.URL, RequestData{})
+		tt.AssertEqual(t, resp.StatusCode, 404)
+
+		var respErr ResponseError[apiError]
+		tt.AssertEqual(t, errors.As(err, &respErr), true)
+		tt.AssertEqual(t, respErr.Method, "GET")
+		tt.AssertEqual(t, respErr.URL, svr.URL)
+		tt.AssertEqual(t, respErr.StatusCode, 404)
+		tt.AssertEqual(t, respErr.Body, apiError{Code: "not_found", Message: "fakeMessage"})
+		tt.AssertErrContains(t, err, "404", "not_found")
+	})
+
+	t.Run("should return the raw error payload by default", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"code":"bad_request"}`)
+		}))
+		defer svr.Close()
+
+		_, _, err := PostJSON[user](ctx, New(time.Second), svr.URL, RequestData{})
+
+		var respErr ResponseError[json.RawMessage]
+		tt.AssertEqual(t, errors.As(err, &respErr), true)
+		tt.AssertEqual(t, string(respErr.Body), `{"code":"bad_request"}`)
+	})
+
+	t.Run("should leave the zero value on empty responses", func(t *testing.T) {
+		for _, test := range []struct {
+			desc   string
+			status int
+			stream bool
+		}{
+			{
+				desc:   "buffered 204 response",
+				status: http.StatusNoContent,
+			},
+			{
+				desc:   "stream 204 response",
+				status: http.StatusNoContent,
+				stream: true,
+			},
+			{
+				desc:   "buffered empty 200 response",
+				status: http.StatusOK,
+			},
+			{
+				desc:   "stream empty 200 response",
+				status: http.StatusOK,
+				stream: true,
+			},
+		} {
+			t.Run(test.desc, func(t *testing.T) {
+				svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(test.status)
+				}))
+				defer svr.Close()
+
+				u, resp, err := DeleteJSON[user](ctx, New(time.Second), svr.URL, RequestData{
+					Stream: test.stream,
+				})
+				tt.AssertNoErr(t, err)
+				tt.AssertEqual(t, resp.StatusCode, test.status)
+				tt.AssertEqual(t, u, user{})
+			})
+		}
+	})
+
+	t.Run("should include the method and url on decoding errors", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, `not json`)
+		}))
+		defer svr.Close()
+
+		_, _, err := GetJSON[user](ctx, New(time.Second), svr.URL, RequestData{})
+		tt.AssertErrContains(t, err, "GET", svr.URL, "JSON")
+	})
+
+	t.Run("should report unsupported methods", func(t *testing.T) {
+		_, _, err := DoJSON[user, apiError](ctx, New(time.Second), "TRACE", "http://localhost", RequestData{})
+		tt.AssertErrContains(t, err, "unsupported", "TRACE")
+	})
+}
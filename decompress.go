@@ -0,0 +1,179 @@
+package krest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Decompressor creates a reader that decodes a response body compressed
+// with a given content coding, e.g. "zstd" or "br".
+type Decompressor func(r io.Reader) (io.ReadCloser, error)
+
+var defaultDecompressors = map[string]Decompressor{
+	"gzip":    newGzipReader,
+	"x-gzip":  newGzipReader,
+	"deflate": newDeflateReader,
+}
+
+// RegisterDecompressor adds support for decompressing responses with
+// the input content coding, e.g. for using the zstd package from
+// `github.com/klauspost/compress`:
+//
+//	client.RegisterDecompressor("zstd", func(r io.Reader) (io.ReadCloser, error) {
+//		d, err := zstd.NewReader(r)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return d.IOReadCloser(), nil
+//	})
+//
+// The gzip and deflate codings are supported by default, and
+// registering them again overrides the default implementations.
+func (c *Client) RegisterDecompressor(encoding string, decompressor Decompressor) {
+	// Copy the map so copies of this Client are not affected:
+	decompressors := map[string]Decompressor{}
+	for k, v := range c.decompressors {
+		decompressors[k] = v
+	}
+	decompressors[strings.ToLower(encoding)] = decompressor
+
+	c.decompressors = decompressors
+}
+
+func (c Client) findDecompressor(encoding string) (Decompressor, bool) {
+	if d, ok := c.decompressors[encoding]; ok {
+		return d, true
+	}
+	d, ok := defaultDecompressors[encoding]
+	return d, ok
+}
+
+// parseContentEncoding returns the content codings of the response in the
+// order they must be decoded, i.e. the reverse of the order they were applied.
+//
+// It returns ok=false if any of the codings is not supported, in
+// which case the body should be returned without changes.
+func (c Client) parseContentEncoding(header http.Header) (decompressors []Decompressor, ok bool) {
+	encodings := splitHeaderList(header.Values("Content-Encoding"))
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(encodings[i])
+		if encoding == "identity" {
+			continue
+		}
+
+		d, ok := c.findDecompressor(encoding)
+		if !ok {
+			return nil, false
+		}
+		decompressors = append(decompressors, d)
+	}
+
+	return decompressors, len(decompressors) > 0
+}
+
+// decompressBody decodes a buffered response body, returning
+// ErrResponseTooLarge if the decoded body is bigger than limit.
+func decompressBody(decompressors []Decompressor, body []byte, limit int64) ([]byte, error) {
+	if len(body) == 0 {
+		return body, nil
+	}
+
+	reader := newDecompressingReadCloser(decompressors, io.NopCloser(bytes.NewReader(body)))
+	defer reader.Close()
+
+	body, err := readLimited(reader, limit)
+	if errors.Is(err, ErrResponseTooLarge) {
+		return body, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing response body: %w", err)
+	}
+
+	return body, nil
+}
+
+// decompressingReadCloser decodes a streamed response body, the decoders
+// are only created on the first call to Read() so empty bodies,
+// e.g. from HEAD requests, don't cause errors.
+type decompressingReadCloser struct {
+	body          io.ReadCloser
+	decompressors []Decompressor
+
+	reader  io.Reader
+	closers []io.Closer
+}
+
+func newDecompressingReadCloser(decompressors []Decompressor, body io.ReadCloser) *decompressingReadCloser {
+	return &decompressingReadCloser{
+		body:          body,
+		decompressors: decompressors,
+	}
+}
+
+// Read implements the io.Reader interface
+func (d *decompressingReadCloser) Read(p []byte) (int, error) {
+	if d.reader == nil {
+		var reader io.Reader = d.body
+		for _, decompressor := range d.decompressors {
+			rc, err := decompressor(reader)
+			if err == io.EOF {
+				// Empty bodies have nothing to decode:
+				return 0, io.EOF
+			}
+			if err != nil {
+				return 0, fmt.Errorf("error decompressing response body: %w", err)
+			}
+			d.closers = append(d.closers, rc)
+			reader = rc
+		}
+		d.reader = reader
+	}
+
+	return d.reader.Read(p)
+}
+
+// Close implements the io.Closer interface
+func (d *decompressingReadCloser) Close() error {
+	var err error
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		if closeErr := d.closers[i].Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := d.body.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func newGzipReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// newDeflateReader decodes the "deflate" coding, which should be
+// zlib-wrapped (RFC 9110), but since some servers send raw deflate
+// streams instead both formats are accepted.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil && len(header) == 0 {
+		return nil, err
+	}
+
+	isZlib := len(header) == 2 &&
+		header[0]&0x0f == 8 &&
+		(uint16(header[0])<<8|uint16(header[1]))%31 == 0
+	if isZlib {
+		return zlib.NewReader(br)
+	}
+
+	return flate.NewReader(br), nil
+}
@@ -0,0 +1,315 @@
+package krest
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestDecompression(t *testing.T) {
+	ctx := context.Background()
+
+	const payload = `{"name":"fakeName"}`
+
+	gzipped := func(data []byte) []byte {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, _ = w.Write(data)
+		_ = w.Close()
+		return buf.Bytes()
+	}
+	zlibbed := func(data []byte) []byte {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		_, _ = w.Write(data)
+		_ = w.Close()
+		return buf.Bytes()
+	}
+	deflated := func(data []byte) []byte {
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		_, _ = w.Write(data)
+		_ = w.Close()
+		return buf.Bytes()
+	}
+
+	t.Run("should decompress responses", func(t *testing.T) {
+		for _, test := range []struct {
+			desc            string
+			contentEncoding string
+			body            []byte
+			stream          bool
+			status          int
+			disable         bool
+
+			expectedBody            string
+			expectedContentEncoding string
+			expectedHeader          string
+		}{
+			{
+				desc:                    "gzip",
+				contentEncoding:         "gzip",
+				body:                    gzipped([]byte(payload)),
+				expectedBody:            payload,
+				expectedContentEncoding: "gzip",
+			},
+			{
+				desc:                    "gzip with the Stream option",
+				contentEncoding:         "gzip",
+				body:                    gzipped([]byte(payload)),
+				stream:                  true,
+				expectedBody:            payload,
+				expectedContentEncoding: "gzip",
+			},
+			{
+				desc:                    "zlib wrapped deflate",
+				contentEncoding:         "deflate",
+				body:                    zlibbed([]byte(payload)),
+				expectedBody:            payload,
+				expectedContentEncoding: "deflate",
+			},
+			{
+				desc:                    "raw deflate",
+				contentEncoding:         "deflate",
+				body:                    deflated([]byte(payload)),
+				stream:                  true,
+				expectedBody:            payload,
+				expectedContentEncoding: "deflate",
+			},
+			{
+				desc:                    "multiple codings",
+				contentEncoding:         "deflate, gzip",
+				body:                    gzipped(zlibbed([]byte(payload))),
+				expectedBody:            payload,
+				expectedContentEncoding: "deflate, gzip",
+			},
+			{
+				desc:                    "error responses",
+				contentEncoding:         "gzip",
+				body:                    gzipped([]byte(payload)),
+				status:                  http.StatusBadRequest,
+				expectedBody:            payload,
+				expectedContentEncoding: "gzip",
+			},
+			{
+				desc:            "unsupported codings",
+				contentEncoding: "unknown",
+				body:            []byte("fakeCompressedBody"),
+				expectedBody:    "fakeCompressedBody",
+				expectedHeader:  "unknown",
+			},
+			{
+				desc:            "disabled decompression",
+				contentEncoding: "gzip",
+				body:            gzipped([]byte(payload)),
+				disable:         true,
+				expectedBody:    string(gzipped([]byte(payload))),
+				expectedHeader:  "gzip",
+			},
+		} {
+			t.Run(test.desc, func(t *testing.T) {
+				svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Encoding", test.contentEncoding)
+					if test.status != 0 {
+						w.WriteHeader(test.status)
+					}
+					_, _ = w.Write(test.body)
+				}))
+				defer svr.Close()
+
+				client := New(time.Second)
+				resp, err := client.Get(ctx, svr.URL, RequestData{
+					Headers: map[string]any{
+						"Accept-Encoding": "gzip, deflate",
+					},
+					Stream:               test.stream,
+					DisableDecompression: test.disable,
+				})
+				if test.status == 0 {
+					tt.AssertNoErr(t, err)
+				} else {
+					tt.AssertErrContains(t, err, payload)
+				}
+
+				body := resp.Body
+				if test.stream {
+					body, err = io.ReadAll(resp)
+					tt.AssertNoErr(t, err)
+					tt.AssertNoErr(t, resp.Close())
+				}
+
+				tt.AssertEqual(t, string(body), test.expectedBody)
+				tt.AssertEqual(t, resp.ContentEncoding, test.expectedContentEncoding)
+				tt.AssertEqual(t, resp.Headers.Get("Content-Encoding"), test.expectedHeader)
+			})
+		}
+	})
+
+	t.Run("should report the encoding decompressed by the transport", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(gzipped([]byte(payload)))
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		resp, err := client.Get(ctx, svr.URL, RequestData{})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, string(resp.Body), payload)
+		tt.AssertEqual(t, resp.ContentEncoding, "gzip")
+	})
+
+	t.Run("should not decompress on the transport when decompression is disabled", func(t *testing.T) {
+		compressed := gzipped([]byte(payload))
+
+		var acceptEncoding string
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			acceptEncoding = r.Header.Get("Accept-Encoding")
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(compressed)
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		resp, err := client.Get(ctx, svr.URL, RequestData{
+			DisableDecompression: true,
+		})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, acceptEncoding, "")
+		tt.AssertEqual(t, resp.Body, compressed)
+		tt.AssertEqual(t, resp.ContentEncoding, "")
+		tt.AssertEqual(t, resp.Headers.Get("Content-Encoding"), "gzip")
+	})
+
+	t.Run("should not fail on empty bodies", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		for _, stream := range []bool{false, true} {
+			resp, err := client.Get(ctx, svr.URL, RequestData{
+				Headers: map[string]any{
+					"Accept-Encoding": "gzip",
+				},
+				Stream: stream,
+			})
+			tt.AssertNoErr(t, err)
+
+			body, err := io.ReadAll(resp)
+			tt.AssertNoErr(t, err)
+			tt.AssertEqual(t, len(body), 0)
+		}
+	})
+
+	t.Run("should use registered decompressors", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "fake")
+			_, _ = w.Write([]byte("FAKENAME"))
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		client.RegisterDecompressor("Fake", func(r io.Reader) (io.ReadCloser, error) {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(strings.NewReader(strings.ToLower(string(data)))), nil
+		})
+
+		resp, err := client.Get(ctx, svr.URL, RequestData{
+			Headers: map[string]any{
+				"Accept-Encoding": "fake",
+			},
+		})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, string(resp.Body), "fakename")
+		tt.AssertEqual(t, resp.ContentEncoding, "fake")
+	})
+
+	t.Run("should verify digests over the encoded content", func(t *testing.T) {
+		compressed := gzipped([]byte(payload))
+		digest, err := computeDigest(DigestSHA256, compressed)
+		tt.AssertNoErr(t, err)
+
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Set("Content-Digest", digest)
+			_, _ = w.Write(compressed)
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		resp, err := client.Get(ctx, svr.URL, RequestData{
+			Headers: map[string]any{
+				"Accept-Encoding": "gzip",
+			},
+			VerifyResponseDigest: true,
+		})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, string(resp.Body), payload)
+	})
+
+	t.Run("should verify digests of gzip responses with the default headers", func(t *testing.T) {
+		compressed := gzipped([]byte(payload))
+		digest, err := computeDigest(DigestSHA256, compressed)
+		tt.AssertNoErr(t, err)
+		wrongDigest, err := computeDigest(DigestSHA256, []byte("fakeContent"))
+		tt.AssertNoErr(t, err)
+
+		for _, test := range []struct {
+			desc      string
+			digest    string
+			expectErr bool
+		}{
+			{
+				desc:   "matching digest",
+				digest: digest,
+			},
+			{
+				desc:      "wrong digest",
+				digest:    wrongDigest,
+				expectErr: true,
+			},
+		} {
+			t.Run(test.desc, func(t *testing.T) {
+				var acceptEncoding string
+				svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					acceptEncoding = r.Header.Get("Accept-Encoding")
+					w.Header().Set("Content-Encoding", "gzip")
+					w.Header().Set("Content-Digest", test.digest)
+					_, _ = w.Write(compressed)
+				}))
+				defer svr.Close()
+
+				client := New(time.Second)
+				resp, err := client.Get(ctx, svr.URL, RequestData{
+					VerifyResponseDigest: true,
+				})
+				tt.AssertEqual(t, acceptEncoding, "gzip")
+				if test.expectErr {
+					var mismatchErr DigestMismatchError
+					tt.AssertEqual(t, errors.As(err, &mismatchErr), true)
+					return
+				}
+				tt.AssertNoErr(t, err)
+				tt.AssertEqual(t, string(resp.Body), payload)
+				tt.AssertEqual(t, resp.ContentEncoding, "gzip")
+			})
+		}
+	})
+}
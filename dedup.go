@@ -0,0 +1,135 @@
+package krest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// NewDedupMiddleware returns a middleware that collapses concurrent
+// identical GET and HEAD requests into a single upstream request.
+//
+// Two requests are considered identical if they share the same method,
+// URL and the same values for each of the headers listed on the
+// `varyHeaders` argument, e.g. "Authorization" or "Accept".
+//
+// Every caller receives its own copy of the response, so it is safe for
+// them to modify it. Requests using the Stream option are never deduplicated.
+//
+// Requests that change how the response is received, e.g. by setting
+// the TLSConfig or MaxResponseBytes options, are only collapsed with
+// requests that use the same values for these options.
+//
+// Note that the context of the first request is used for the upstream call,
+// the other callers will stop waiting if their own contexts are cancelled,
+// and if the first request is cancelled the callers still waiting will
+// make a new upstream request instead of receiving its cancellation error.
+func NewDedupMiddleware(varyHeaders ...string) Middleware {
+	var mutex sync.Mutex
+	inflight := map[string]*inflightRequest{}
+
+	return func(
+		ctx context.Context,
+		method string,
+		url string,
+		data RequestData,
+		next NextMiddleware,
+	) (Response, error) {
+		method = strings.ToUpper(method)
+		if data.Stream || (method != "GET" && method != "HEAD") {
+			return next(ctx, method, url, data)
+		}
+
+		key := dedupKey(method, url, data, varyHeaders)
+
+		for {
+			mutex.Lock()
+			call, found := inflight[key]
+			if !found {
+				call = &inflightRequest{
+					done: make(chan struct{}),
+				}
+				inflight[key] = call
+			}
+			mutex.Unlock()
+
+			if found {
+				select {
+				case <-ctx.Done():
+					return Response{}, ctx.Err()
+				case <-call.done:
+				}
+
+				if call.cancelled {
+					// The context of the first caller was cancelled,
+					// so we try again with our own context:
+					continue
+				}
+				return copyResponse(call.resp), call.err
+			}
+
+			call.resp, call.err = next(ctx, method, url, data)
+			call.cancelled = ctx.Err() != nil
+
+			mutex.Lock()
+			delete(inflight, key)
+			mutex.Unlock()
+			close(call.done)
+
+			return copyResponse(call.resp), call.err
+		}
+	}
+}
+
+type inflightRequest struct {
+	done      chan struct{}
+	resp      Response
+	err       error
+	cancelled bool
+}
+
+func dedupKey(method string, url string, data RequestData, varyHeaders []string) string {
+	var key strings.Builder
+	key.WriteString(method)
+	key.WriteString(" ")
+	key.WriteString(url)
+	for _, name := range varyHeaders {
+		key.WriteString("\n")
+		key.WriteString(http.CanonicalHeaderKey(name))
+		key.WriteString(": ")
+		key.WriteString(getHeader(data.Headers, name))
+	}
+
+	// The options that change how the response is received:
+	fmt.Fprintf(&key,
+		"\ndecompression=%t digest=%t maxBytes=%d tls=%p redirects=%t",
+		!data.DisableDecompression,
+		data.VerifyResponseDigest,
+		data.MaxResponseBytes,
+		data.TLSConfig,
+		data.FollowRedirects,
+	)
+
+	return key.String()
+}
+
+// copyResponse makes a deep copy of a buffered response,
+// giving it a new ReadCloser that reads from the copied body.
+func copyResponse(resp Response) Response {
+	body := resp.Body
+	if body != nil {
+		body = append([]byte(nil), body...)
+	}
+
+	return Response{
+		ReadCloser:      io.NopCloser(bytes.NewReader(body)),
+		Body:            body,
+		Headers:         resp.Headers.Clone(),
+		StatusCode:      resp.StatusCode,
+		ContentEncoding: resp.ContentEncoding,
+	}
+}
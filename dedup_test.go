@@ -0,0 +1,199 @@
+package krest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestDedupMiddleware(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should collapse concurrent identical requests", func(t *testing.T) {
+		var numRequests int32
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&numRequests, 1)
+			time.Sleep(100 * time.Millisecond)
+			_, _ = fmt.Fprint(w, "fakeConfig")
+		}))
+		defer svr.Close()
+
+		client := New(time.Second, NewDedupMiddleware())
+
+		var wg sync.WaitGroup
+		responses := make([]Response, 10)
+		errs := make([]error, 10)
+		for i := range responses {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				responses[i], errs[i] = client.Get(ctx, svr.URL, RequestData{})
+			}(i)
+		}
+		wg.Wait()
+
+		tt.AssertEqual(t, atomic.LoadInt32(&numRequests), int32(1))
+		for i := range responses {
+			tt.AssertNoErr(t, errs[i])
+			tt.AssertEqual(t, string(responses[i].Body), "fakeConfig")
+		}
+
+		// Each caller must get its own copy of the body:
+		responses[0].Body[0] = 'X'
+		tt.AssertEqual(t, string(responses[1].Body), "fakeConfig")
+	})
+
+	t.Run("should not collapse requests with different vary headers", func(t *testing.T) {
+		var numRequests int32
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&numRequests, 1)
+			time.Sleep(100 * time.Millisecond)
+			_, _ = fmt.Fprint(w, r.Header.Get("Authorization"))
+		}))
+		defer svr.Close()
+
+		client := New(time.Second, NewDedupMiddleware("Authorization"))
+
+		var wg sync.WaitGroup
+		responses := make([]Response, 4)
+		for i := range responses {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				responses[i], _ = client.Get(ctx, svr.URL, RequestData{
+					Headers: map[string]any{
+						"Authorization": fmt.Sprint("token", i%2),
+					},
+				})
+			}(i)
+		}
+		wg.Wait()
+
+		tt.AssertEqual(t, atomic.LoadInt32(&numRequests), int32(2))
+		for i := range responses {
+			tt.AssertEqual(t, string(responses[i].Body), fmt.Sprint("token", i%2))
+		}
+	})
+
+	t.Run("should not collapse requests with different options", func(t *testing.T) {
+		for _, test := range []struct {
+			desc string
+			data RequestData
+		}{
+			{
+				desc: "disable decompression",
+				data: RequestData{DisableDecompression: true},
+			},
+			{
+				desc: "verify response digest",
+				data: RequestData{VerifyResponseDigest: true},
+			},
+			{
+				desc: "max response bytes",
+				data: RequestData{MaxResponseBytes: 100},
+			},
+			{
+				desc: "tls config",
+				data: RequestData{TLSConfig: &tls.Config{}},
+			},
+			{
+				desc: "follow redirects",
+				data: RequestData{FollowRedirects: true},
+			},
+		} {
+			t.Run(test.desc, func(t *testing.T) {
+				var numRequests int32
+				svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&numRequests, 1)
+					time.Sleep(100 * time.Millisecond)
+					_, _ = fmt.Fprint(w, "fakeConfig")
+				}))
+				defer svr.Close()
+
+				client := New(time.Second, NewDedupMiddleware())
+
+				var wg sync.WaitGroup
+				for _, data := range []RequestData{{}, test.data} {
+					wg.Add(1)
+					go func(data RequestData) {
+						defer wg.Done()
+						_, err := client.Get(ctx, svr.URL, data)
+						tt.AssertNoErr(t, err)
+					}(data)
+				}
+				wg.Wait()
+
+				tt.AssertEqual(t, atomic.LoadInt32(&numRequests), int32(2))
+			})
+		}
+	})
+
+	t.Run("should not pass the cancellation of the first request to the others", func(t *testing.T) {
+		var numRequests int32
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&numRequests, 1)
+			time.Sleep(100 * time.Millisecond)
+			_, _ = fmt.Fprint(w, "fakeConfig")
+		}))
+		defer svr.Close()
+
+		client := New(time.Second, NewDedupMiddleware())
+
+		leaderCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		var leaderErr error
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, leaderErr = client.Get(leaderCtx, svr.URL, RequestData{})
+		}()
+
+		// Give the first request time to become the leader:
+		time.Sleep(10 * time.Millisecond)
+
+		resp, err := client.Get(ctx, svr.URL, RequestData{})
+		wg.Wait()
+
+		tt.AssertErrContains(t, leaderErr, "context deadline exceeded")
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, string(resp.Body), "fakeConfig")
+		tt.AssertEqual(t, atomic.LoadInt32(&numRequests), int32(2))
+	})
+
+	t.Run("should not collapse streaming requests", func(t *testing.T) {
+		var numRequests int32
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&numRequests, 1)
+			time.Sleep(50 * time.Millisecond)
+		}))
+		defer svr.Close()
+
+		client := New(time.Second, NewDedupMiddleware())
+
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := client.Get(ctx, svr.URL, RequestData{
+					Stream: true,
+				})
+				tt.AssertNoErr(t, err)
+				_ = resp.Close()
+			}()
+		}
+		wg.Wait()
+
+		tt.AssertEqual(t, atomic.LoadInt32(&numRequests), int32(3))
+	})
+}
@@ -0,0 +1,265 @@
+package krest
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// NewDigestAuthMiddleware returns a middleware that authenticates
+// requests using HTTP Digest Authentication as described on RFC 7616.
+//
+// When a request receives a `401` response with a `Digest` challenge the
+// request is replayed with the computed credentials, and the challenge is
+// cached per host so later requests can authenticate preemptively.
+//
+// The MD5, SHA-256 and SHA-512-256 algorithms are supported, as well as
+// their session variants, and only the `auth` quality of protection is used.
+func NewDigestAuthMiddleware(username string, password string) Middleware {
+	auth := digestAuth{
+		username:   username,
+		password:   password,
+		challenges: map[string]*digestChallenge{},
+		newCnonce:  randomCnonce,
+	}
+	return auth.middleware
+}
+
+type digestAuth struct {
+	username string
+	password string
+
+	mutex      sync.Mutex
+	challenges map[string]*digestChallenge
+
+	newCnonce func() string
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+
+	// nc is the nonce count sent on the last request
+	nc int
+}
+
+func (d *digestAuth) middleware(
+	ctx context.Context,
+	method string,
+	rawURL string,
+	data RequestData,
+	next NextMiddleware,
+) (Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Response{}, fmt.Errorf("unable to parse url for digest authentication: %w", err)
+	}
+
+	nextData := data
+	authorization, found := d.authorization(u.Host, method, u.RequestURI())
+	if found {
+		nextData.Headers = copyHeaders(data.Headers)
+		setHeader(nextData.Headers, "Authorization", authorization)
+	}
+
+	resp, err := next(ctx, method, rawURL, nextData)
+	if resp.StatusCode != http.StatusUnauthorized || !isReplayableBody(data.Body) {
+		return resp, err
+	}
+
+	challenge, ok := parseDigestChallenge(resp.Headers.Values("WWW-Authenticate"))
+	if !ok {
+		return resp, err
+	}
+
+	d.mutex.Lock()
+	d.challenges[u.Host] = challenge
+	d.mutex.Unlock()
+
+	authorization, _ = d.authorization(u.Host, method, u.RequestURI())
+	nextData.Headers = copyHeaders(data.Headers)
+	setHeader(nextData.Headers, "Authorization", authorization)
+
+	return next(ctx, method, rawURL, nextData)
+}
+
+func (d *digestAuth) authorization(host string, method string, uri string) (string, bool) {
+	d.mutex.Lock()
+	challenge, found := d.challenges[host]
+	if !found {
+		d.mutex.Unlock()
+		return "", false
+	}
+	challenge.nc++
+	c := *challenge
+	d.mutex.Unlock()
+
+	cnonce := d.newCnonce()
+	nc := fmt.Sprintf("%08x", c.nc)
+	response := c.response(d.username, d.password, method, uri, nc, cnonce)
+
+	params := []string{
+		fmt.Sprintf("username=%q", d.username),
+		fmt.Sprintf("realm=%q", c.realm),
+		fmt.Sprintf("uri=%q", uri),
+		"algorithm=" + c.algorithm,
+		fmt.Sprintf("nonce=%q", c.nonce),
+	}
+	if c.qop != "" {
+		params = append(params,
+			"nc="+nc,
+			fmt.Sprintf("cnonce=%q", cnonce),
+			"qop="+c.qop,
+		)
+	}
+	params = append(params, fmt.Sprintf("response=%q", response))
+	if c.opaque != "" {
+		params = append(params, fmt.Sprintf("opaque=%q", c.opaque))
+	}
+
+	return "Digest " + strings.Join(params, ", "), true
+}
+
+// response computes the `response` parameter as described on RFC 7616 section 3.4.1
+func (c digestChallenge) response(username, password, method, uri, nc, cnonce string) string {
+	h := func(s string) string {
+		hash := newDigestAuthHash(c.algorithm)
+		hash.Write([]byte(s))
+		return hex.EncodeToString(hash.Sum(nil))
+	}
+
+	ha1 := h(username + ":" + c.realm + ":" + password)
+	if strings.HasSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := h(strings.ToUpper(method) + ":" + uri)
+
+	if c.qop == "" {
+		return h(ha1 + ":" + c.nonce + ":" + ha2)
+	}
+	return h(strings.Join([]string{ha1, c.nonce, nc, cnonce, c.qop, ha2}, ":"))
+}
+
+// digestAlgorithmStrength lists the supported algorithms
+// from the weakest to the strongest one.
+var digestAlgorithmStrength = map[string]int{
+	"MD5":              1,
+	"MD5-SESS":         1,
+	"SHA-256":          2,
+	"SHA-256-SESS":     2,
+	"SHA-512-256":      3,
+	"SHA-512-256-SESS": 3,
+}
+
+func newDigestAuthHash(algorithm string) hash.Hash {
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "SHA-256":
+		return sha256.New()
+	case "SHA-512-256":
+		return sha512.New512_256()
+	default:
+		return md5.New()
+	}
+}
+
+// parseDigestChallenge parses the `WWW-Authenticate` header values
+// returning the Digest challenge with the strongest supported algorithm.
+func parseDigestChallenge(headerValues []string) (*digestChallenge, bool) {
+	var chosen *digestChallenge
+	for _, params := range parseAuthChallenges(headerValues, "digest") {
+		algorithm := params["algorithm"]
+		if algorithm == "" {
+			algorithm = "MD5"
+		}
+		if digestAlgorithmStrength[strings.ToUpper(algorithm)] == 0 {
+			continue
+		}
+
+		var qop string
+		if params["qop"] != "" {
+			for _, option := range strings.Split(params["qop"], ",") {
+				if strings.TrimSpace(option) == "auth" {
+					qop = "auth"
+				}
+			}
+			if qop == "" {
+				// Only `auth-int` is available which we don't support:
+				continue
+			}
+		}
+
+		if chosen != nil && digestAlgorithmStrength[strings.ToUpper(chosen.algorithm)] >= digestAlgorithmStrength[strings.ToUpper(algorithm)] {
+			continue
+		}
+
+		chosen = &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: algorithm,
+			qop:       qop,
+		}
+	}
+
+	return chosen, chosen != nil
+}
+
+// parseAuthChallenges parses the challenges of the input scheme
+// from `WWW-Authenticate` headers, which might contain several
+// challenges on the same line, e.g.:
+//
+//	Digest realm="api", nonce="abc", algorithm=SHA-256, Basic realm="api"
+func parseAuthChallenges(headerValues []string, scheme string) []map[string]string {
+	var challenges []map[string]string
+	var current map[string]string
+	for _, part := range splitOutsideQuotes(strings.Join(headerValues, ","), ',') {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		// A new challenge starts with a token followed by a space instead of `=`:
+		if i := strings.IndexAny(part, " ="); i < 0 || part[i] == ' ' {
+			current = nil
+			if strings.EqualFold(strings.Fields(part)[0], scheme) {
+				current = map[string]string{}
+				challenges = append(challenges, current)
+			}
+			if i < 0 {
+				continue
+			}
+			part = strings.TrimSpace(part[i+1:])
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if current == nil || len(kv) != 2 {
+			continue
+		}
+
+		value := strings.TrimSpace(kv[1])
+		if strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) && len(value) >= 2 {
+			value = strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`)
+		}
+		current[strings.ToLower(strings.TrimSpace(kv[0]))] = value
+	}
+
+	return challenges
+}
+
+func randomCnonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,109 @@
+package krest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestDigestAuth(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should match the examples from RFC 7616", func(t *testing.T) {
+		for _, test := range []struct {
+			algorithm        string
+			expectedResponse string
+		}{
+			{
+				algorithm:        "MD5",
+				expectedResponse: "8ca523f5e9506fed4657c9700eebdbec",
+			},
+			{
+				algorithm:        "SHA-256",
+				expectedResponse: "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+			},
+		} {
+			t.Run(test.algorithm, func(t *testing.T) {
+				challenge := digestChallenge{
+					realm:     "http-auth@example.org",
+					nonce:     "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+					algorithm: test.algorithm,
+					qop:       "auth",
+				}
+
+				response := challenge.response(
+					"Mufasa", "Circle of Life", "GET", "/dir/index.html",
+					"00000001", "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+				)
+				tt.AssertEqual(t, response, test.expectedResponse)
+			})
+		}
+	})
+
+	t.Run("should parse multiple challenges choosing the strongest algorithm", func(t *testing.T) {
+		challenge, ok := parseDigestChallenge([]string{
+			`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=MD5, nonce="fakeNonce1", opaque="fakeOpaque"`,
+			`Basic realm="other", Digest realm="http-auth@example.org", qop="auth", algorithm=SHA-256, nonce="fakeNonce2"`,
+		})
+		tt.AssertEqual(t, ok, true)
+		tt.AssertEqual(t, *challenge, digestChallenge{
+			realm:     "http-auth@example.org",
+			nonce:     "fakeNonce2",
+			algorithm: "SHA-256",
+			qop:       "auth",
+		})
+
+		_, ok = parseDigestChallenge([]string{`Basic realm="other"`})
+		tt.AssertEqual(t, ok, false)
+	})
+
+	t.Run("should answer the challenge and authenticate preemptively afterwards", func(t *testing.T) {
+		var authHeaders []string
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization := r.Header.Get("Authorization")
+			authHeaders = append(authHeaders, authorization)
+
+			params := parseAuthChallenges([]string{authorization}, "digest")
+			if len(params) == 0 {
+				w.Header().Set("WWW-Authenticate",
+					`Digest realm="fakeRealm", qop="auth", algorithm=SHA-512-256, nonce="fakeNonce", opaque="fakeOpaque"`,
+				)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			challenge := digestChallenge{
+				realm:     "fakeRealm",
+				nonce:     "fakeNonce",
+				algorithm: "SHA-512-256",
+				qop:       "auth",
+			}
+			expected := challenge.response("fakeUser", "fakePass", r.Method, r.URL.RequestURI(), params[0]["nc"], params[0]["cnonce"])
+			if params[0]["response"] != expected || params[0]["opaque"] != "fakeOpaque" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+		defer svr.Close()
+
+		client := New(time.Second, NewDigestAuthMiddleware("fakeUser", "fakePass"))
+
+		resp, err := client.Get(ctx, svr.URL+"/some/path?foo=bar", RequestData{})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, resp.StatusCode, 200)
+
+		resp, err = client.Post(ctx, svr.URL+"/other/path", RequestData{
+			Body: map[string]string{"fake": "body"},
+		})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, resp.StatusCode, 200)
+
+		tt.AssertEqual(t, len(authHeaders), 3)
+		tt.AssertEqual(t, authHeaders[0], "")
+		tt.AssertContains(t, authHeaders[1], `uri="/some/path?foo=bar"`, "nc=00000001", "algorithm=SHA-512-256")
+		tt.AssertContains(t, authHeaders[2], `uri="/other/path"`, "nc=00000002")
+	})
+}
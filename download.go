@@ -0,0 +1,559 @@
+package krest
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minDownloadChunkSize is the minimum size of each
+// range when DownloadOptions.Concurrency is used.
+var minDownloadChunkSize int64 = 1024 * 1024
+
+// ErrChecksumMismatch is returned by client.Download() when
+// the checksum of the downloaded file doesn't match the expected one.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// DownloadOptions describes the optional arguments of client.Download()
+type DownloadOptions struct {
+	Headers   map[string]any
+	TLSConfig *tls.Config
+
+	// FollowRedirects works the same way as RequestData.FollowRedirects
+	FollowRedirects bool
+
+	// It's the max number of attempts, if 0 it defaults to 5,
+	// each retry resumes the download from where the last one stopped
+	MaxRetries int
+
+	// The start and max delay for the exponential backoff strategy
+	// if unset they default to 300ms and 32s respectively
+	BaseRetryDelay time.Duration
+	MaxRetryDelay  time.Duration
+
+	// Concurrency is the number of byte ranges downloaded in parallel, if
+	// the server doesn't advertise `Accept-Ranges: bytes` on a HEAD request
+	// the file is downloaded as a single stream, which is the default.
+	//
+	// Parallel downloads are not resumed by later calls to client.Download().
+	Concurrency int
+
+	// Checksum is the hex encoded digest of the whole file, if set the file
+	// is verified before being renamed to its destination using the algorithm
+	// set on ChecksumAlgorithm, which defaults to krest.DigestSHA256.
+	Checksum          string
+	ChecksumAlgorithm string
+}
+
+func (o *DownloadOptions) setDefaultsIfNecessary() {
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 5
+	}
+	if o.BaseRetryDelay == 0 {
+		o.BaseRetryDelay = 300 * time.Millisecond
+	}
+	if o.MaxRetryDelay == 0 {
+		o.MaxRetryDelay = 32 * time.Second
+	}
+	if o.ChecksumAlgorithm == "" {
+		o.ChecksumAlgorithm = DigestSHA256
+	}
+}
+
+// Download saves the response body of a GET request on the `dest` path.
+//
+// The body is first written to `dest + ".part"`, and only renamed to `dest`
+// once it is complete and its checksum, if any, is verified. If the download
+// is interrupted the next attempts, including the ones made by later calls to
+// this function, resume from where it stopped using the `Range` header along
+// with `If-Range`, so the download restarts if the file changed on the server.
+//
+// The `If-Range` validator is the ETag of the response, or its Last-Modified
+// if there is no strong ETag, and it is kept on `dest + ".part.meta"`.
+func (c Client) Download(ctx context.Context, url string, dest string, opts DownloadOptions) error {
+	opts.setDefaultsIfNecessary()
+
+	d := &download{
+		client:   c,
+		url:      url,
+		opts:     opts,
+		partPath: dest + ".part",
+		metaPath: dest + ".part.meta",
+	}
+
+	file, err := os.OpenFile(d.partPath, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening download file: %w", err)
+	}
+	defer file.Close()
+
+	err = d.loadState(file)
+	if err != nil {
+		return err
+	}
+
+	var done bool
+	if opts.Concurrency > 1 && d.offset == 0 {
+		done, err = d.parallelDownload(ctx, file)
+	}
+	if !done {
+		Retry(ctx, opts.BaseRetryDelay, opts.MaxRetryDelay, opts.MaxRetries, func() bool {
+			var shouldRetry bool
+			shouldRetry, err = d.attempt(ctx, file)
+			return shouldRetry
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("error downloading %s: %w", url, err)
+	}
+
+	if opts.Checksum != "" {
+		err = d.verifyChecksum()
+		if err != nil {
+			_ = file.Close()
+			d.removeFiles()
+			return err
+		}
+	}
+
+	err = file.Sync()
+	if err == nil {
+		err = file.Close()
+	}
+	if err == nil {
+		err = os.Rename(d.partPath, dest)
+	}
+	if err != nil {
+		return fmt.Errorf("error saving downloaded file: %w", err)
+	}
+	_ = os.Remove(d.metaPath)
+
+	return nil
+}
+
+type download struct {
+	client   Client
+	url      string
+	opts     DownloadOptions
+	partPath string
+	metaPath string
+
+	offset int64
+	state  downloadState
+}
+
+// downloadState is persisted on the `.part.meta` file
+// so later calls can resume the download.
+type downloadState struct {
+	// Validator is the value sent on the If-Range header
+	Validator string `json:"validator"`
+
+	// Size is the total size of the file or -1 if unknown
+	Size int64 `json:"size"`
+}
+
+func (d *download) loadState(file *os.File) error {
+	d.state.Size = -1
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("error reading download file: %w", err)
+	}
+
+	data, err := os.ReadFile(d.metaPath)
+	if err == nil {
+		err = json.Unmarshal(data, &d.state)
+	}
+	if err != nil || !d.canResume(info.Size()) {
+		// There is no way of knowing if the partial
+		// file is still valid so we start from scratch:
+		return d.reset(file)
+	}
+
+	d.offset = info.Size()
+	return nil
+}
+
+func (d *download) canResume(offset int64) bool {
+	if d.state.Size >= 0 && offset > d.state.Size {
+		return false
+	}
+	return d.state.Validator != "" || d.state.Size >= 0
+}
+
+func (d *download) reset(file *os.File) error {
+	d.offset = 0
+	d.state = downloadState{Size: -1}
+	_ = os.Remove(d.metaPath)
+
+	err := file.Truncate(0)
+	if err != nil {
+		return fmt.Errorf("error truncating download file: %w", err)
+	}
+	return nil
+}
+
+func (d *download) saveState(resp Response, size int64) error {
+	d.state = downloadState{
+		Validator: rangeValidator(resp.Headers),
+		Size:      size,
+	}
+
+	data, err := json.Marshal(d.state)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(d.metaPath, data, 0o644)
+	if err != nil {
+		return fmt.Errorf("error saving download state: %w", err)
+	}
+	return nil
+}
+
+// attempt makes a single request, resuming from the current offset
+// and appending the body to the file, it returns shouldRetry=true
+// for errors that might be fixed by resuming the download.
+func (d *download) attempt(ctx context.Context, file *os.File) (shouldRetry bool, _ error) {
+	headers := d.headers()
+	if d.offset > 0 {
+		setHeader(headers, "Range", fmt.Sprintf("bytes=%d-", d.offset))
+		if d.state.Validator != "" {
+			setHeader(headers, "If-Range", d.state.Validator)
+		}
+	}
+
+	resp, err := d.client.makeRequestWithMiddlewares(ctx, "GET", d.url, RequestData{
+		Headers:              headers,
+		TLSConfig:            d.opts.TLSConfig,
+		FollowRedirects:      d.opts.FollowRedirects,
+		Stream:               true,
+		DisableDecompression: true,
+	})
+	if err != nil {
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && d.offset > 0 {
+			size, parseErr := strconv.ParseInt(strings.TrimPrefix(resp.Headers.Get("Content-Range"), "bytes */"), 10, 64)
+			if d.offset == d.state.Size || (parseErr == nil && d.offset == size) {
+				// The file was already complete:
+				return false, nil
+			}
+			return true, errors.Join(err, d.reset(file))
+		}
+		return isRetriableDownloadStatus(resp.StatusCode), err
+	}
+	defer resp.Close()
+
+	if resp.StatusCode == http.StatusPartialContent {
+		start, total, err := parseContentRange(resp.Headers.Get("Content-Range"))
+		if err != nil {
+			return false, err
+		}
+		if start != d.offset {
+			return false, fmt.Errorf(
+				"expected Content-Range to start at %d but got: '%s'",
+				d.offset, resp.Headers.Get("Content-Range"),
+			)
+		}
+		if d.state.Size >= 0 && total != d.state.Size {
+			// The file changed on the server:
+			return true, errors.Join(
+				fmt.Errorf("file size changed from %d to %d", d.state.Size, total),
+				d.reset(file),
+			)
+		}
+		d.state.Size = total
+	} else {
+		// The server ignored the Range header, either because it
+		// doesn't support it or because the file has changed:
+		if d.offset > 0 {
+			err = d.reset(file)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		size, err := strconv.ParseInt(resp.Headers.Get("Content-Length"), 10, 64)
+		if err != nil {
+			size = -1
+		}
+		err = d.saveState(resp, size)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = file.Seek(d.offset, io.SeekStart)
+	if err != nil {
+		return false, fmt.Errorf("error writing download file: %w", err)
+	}
+
+	n, err := io.Copy(file, resp)
+	d.offset += n
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+
+	if d.state.Size >= 0 && d.offset != d.state.Size {
+		return true, fmt.Errorf(
+			"download stopped at %d of %d bytes: %w",
+			d.offset, d.state.Size, io.ErrUnexpectedEOF,
+		)
+	}
+
+	return false, nil
+}
+
+// parallelDownload downloads the file as `Concurrency` byte ranges in
+// parallel, it returns done=false if the server doesn't support ranges.
+func (d *download) parallelDownload(ctx context.Context, file *os.File) (done bool, _ error) {
+	resp, err := d.client.makeRequestWithMiddlewares(ctx, "HEAD", d.url, RequestData{
+		Headers:         d.headers(),
+		TLSConfig:       d.opts.TLSConfig,
+		FollowRedirects: d.opts.FollowRedirects,
+	})
+	if err != nil || !strings.EqualFold(resp.Headers.Get("Accept-Ranges"), "bytes") {
+		// The single stream download will report any errors:
+		return false, nil
+	}
+
+	size, err := strconv.ParseInt(resp.Headers.Get("Content-Length"), 10, 64)
+	if err != nil || size < 2*minDownloadChunkSize {
+		return false, nil
+	}
+
+	chunks := int64(d.opts.Concurrency)
+	if size/chunks < minDownloadChunkSize {
+		chunks = size / minDownloadChunkSize
+	}
+
+	err = file.Truncate(size)
+	if err != nil {
+		return true, fmt.Errorf("error allocating download file: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	validator := rangeValidator(resp.Headers)
+	chunkSize := size / chunks
+	errs := make([]error, chunks)
+
+	var wg sync.WaitGroup
+	for i := int64(0); i < chunks; i++ {
+		start, end := i*chunkSize, (i+1)*chunkSize-1
+		if i == chunks-1 {
+			end = size - 1
+		}
+
+		wg.Add(1)
+		go func(i int64) {
+			defer wg.Done()
+			errs[i] = d.downloadRange(ctx, file, start, end, validator)
+			if errs[i] != nil {
+				// There is no point in downloading the other chunks:
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Report the error that caused the cancellation instead of the
+	// context.Canceled errors returned by the other chunks:
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return true, err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// downloadRange downloads the bytes from start to end (inclusive) writing them
+// at the same offsets on the file, retries resume from the last byte received.
+func (d *download) downloadRange(ctx context.Context, file *os.File, start int64, end int64, validator string) (err error) {
+	offset := start
+	Retry(ctx, d.opts.BaseRetryDelay, d.opts.MaxRetryDelay, d.opts.MaxRetries, func() bool {
+		var shouldRetry bool
+		shouldRetry, err = d.attemptRange(ctx, file, &offset, end, validator)
+		return shouldRetry
+	})
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+func (d *download) attemptRange(
+	ctx context.Context,
+	file *os.File,
+	offset *int64,
+	end int64,
+	validator string,
+) (shouldRetry bool, _ error) {
+	headers := d.headers()
+	setHeader(headers, "Range", fmt.Sprintf("bytes=%d-%d", *offset, end))
+	if validator != "" {
+		setHeader(headers, "If-Range", validator)
+	}
+
+	resp, err := d.client.makeRequestWithMiddlewares(ctx, "GET", d.url, RequestData{
+		Headers:              headers,
+		TLSConfig:            d.opts.TLSConfig,
+		FollowRedirects:      d.opts.FollowRedirects,
+		Stream:               true,
+		DisableDecompression: true,
+	})
+	if err != nil {
+		return isRetriableDownloadStatus(resp.StatusCode), err
+	}
+	defer resp.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		// Either the file changed on the server or it stopped supporting ranges:
+		return false, fmt.Errorf(
+			"expected status %d for range %d-%d but got %d",
+			http.StatusPartialContent, *offset, end, resp.StatusCode,
+		)
+	}
+
+	start, _, err := parseContentRange(resp.Headers.Get("Content-Range"))
+	if err != nil {
+		return false, err
+	}
+	if start != *offset {
+		return false, fmt.Errorf(
+			"expected Content-Range to start at %d but got: '%s'",
+			*offset, resp.Headers.Get("Content-Range"),
+		)
+	}
+
+	n, err := io.Copy(io.NewOffsetWriter(file, *offset), io.LimitReader(resp, end-*offset+1))
+	*offset += n
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+
+	if *offset != end+1 {
+		return true, fmt.Errorf(
+			"range %d-%d stopped at %d: %w",
+			start, end, *offset, io.ErrUnexpectedEOF,
+		)
+	}
+
+	return false, nil
+}
+
+func (d *download) headers() map[string]any {
+	headers := copyHeaders(d.opts.Headers)
+	if getHeader(headers, "Accept-Encoding") == "" {
+		// Byte ranges are only meaningful for the body as it is sent:
+		headers["Accept-Encoding"] = "identity"
+	}
+	return headers
+}
+
+func (d *download) verifyChecksum() error {
+	h, err := newDigestHash(d.opts.ChecksumAlgorithm)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(d.partPath)
+	if err != nil {
+		return fmt.Errorf("error reading download file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return fmt.Errorf("error reading download file: %w", err)
+	}
+
+	got := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(got, d.opts.Checksum) {
+		return fmt.Errorf(
+			"%w for %s: expected %s but got %s",
+			ErrChecksumMismatch, d.opts.ChecksumAlgorithm, d.opts.Checksum, got,
+		)
+	}
+
+	return nil
+}
+
+func (d *download) removeFiles() {
+	_ = os.Remove(d.partPath)
+	_ = os.Remove(d.metaPath)
+}
+
+// rangeValidator returns the value for the If-Range header, which
+// must be either a strong ETag or a Last-Modified date (RFC 9110).
+func rangeValidator(headers http.Header) string {
+	etag := headers.Get("ETag")
+	if etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return headers.Get("Last-Modified")
+}
+
+// parseContentRange parses headers such as "bytes 100-199/1000",
+// the total is -1 if the server sent "*" instead of the size.
+func parseContentRange(header string) (start int64, total int64, err error) {
+	invalidErr := fmt.Errorf("invalid Content-Range header: '%s'", header)
+
+	spec := strings.TrimPrefix(header, "bytes ")
+	if spec == header {
+		return 0, 0, invalidErr
+	}
+
+	i := strings.Index(spec, "/")
+	if i < 0 {
+		return 0, 0, invalidErr
+	}
+	byteRange, size := spec[:i], spec[i+1:]
+
+	j := strings.Index(byteRange, "-")
+	if j < 0 {
+		return 0, 0, invalidErr
+	}
+
+	start, err = strconv.ParseInt(byteRange[:j], 10, 64)
+	if err != nil {
+		return 0, 0, invalidErr
+	}
+	end, err := strconv.ParseInt(byteRange[j+1:], 10, 64)
+	if err != nil || end < start {
+		return 0, 0, invalidErr
+	}
+
+	total = -1
+	if size != "*" {
+		total, err = strconv.ParseInt(size, 10, 64)
+		if err != nil || total <= end {
+			return 0, 0, invalidErr
+		}
+	}
+
+	return start, total, nil
+}
+
+func isRetriableDownloadStatus(status int) bool {
+	return status == 0 ||
+		status == http.StatusRequestTimeout ||
+		status == http.StatusTooManyRequests ||
+		status >= 500
+}
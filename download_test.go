@@ -0,0 +1,371 @@
+package krest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestDownload(t *testing.T) {
+	ctx := context.Background()
+
+	randMillis = func() time.Duration {
+		return 0
+	}
+	defer func() {
+		randMillis = DefaultRandMillis
+	}()
+
+	content := []byte(strings.Repeat("0123456789", 1000))
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	type request struct {
+		rangeHeader string
+		ifRange     string
+	}
+
+	// newServer serves the content with support for Range requests,
+	// aborting the first `interruptions` responses halfway through:
+	newServer := func(etag func(attempt int) string, interruptions int) (*httptest.Server, func() []request) {
+		var mu sync.Mutex
+		var requests []request
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests = append(requests, request{
+				rangeHeader: r.Header.Get("Range"),
+				ifRange:     r.Header.Get("If-Range"),
+			})
+			attempt := len(requests)
+			mu.Unlock()
+
+			w.Header().Set("ETag", etag(attempt))
+			if attempt <= interruptions {
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				_, _ = w.Write(content[:len(content)/2])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		}))
+
+		return svr, func() []request {
+			mu.Lock()
+			defer mu.Unlock()
+			return requests
+		}
+	}
+
+	staticETag := func(int) string { return `"v1"` }
+
+	assertDownloaded := func(t *testing.T, dest string) {
+		data, err := os.ReadFile(dest)
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, bytes.Equal(data, content), true)
+
+		_, err = os.Stat(dest + ".part")
+		tt.AssertEqual(t, os.IsNotExist(err), true)
+		_, err = os.Stat(dest + ".part.meta")
+		tt.AssertEqual(t, os.IsNotExist(err), true)
+	}
+
+	t.Run("should download files", func(t *testing.T) {
+		svr, requests := newServer(staticETag, 0)
+		defer svr.Close()
+
+		dest := filepath.Join(t.TempDir(), "file")
+
+		client := New(time.Second)
+		err := client.Download(ctx, svr.URL, dest, DownloadOptions{
+			Checksum: checksum,
+		})
+		tt.AssertNoErr(t, err)
+
+		assertDownloaded(t, dest)
+		tt.AssertEqual(t, requests(), []request{{}})
+	})
+
+	t.Run("should resume interrupted downloads", func(t *testing.T) {
+		svr, requests := newServer(staticETag, 1)
+		defer svr.Close()
+
+		dest := filepath.Join(t.TempDir(), "file")
+
+		client := New(time.Second)
+		err := client.Download(ctx, svr.URL, dest, DownloadOptions{
+			BaseRetryDelay: time.Millisecond,
+			Checksum:       checksum,
+		})
+		tt.AssertNoErr(t, err)
+
+		assertDownloaded(t, dest)
+		tt.AssertEqual(t, requests(), []request{
+			{},
+			{rangeHeader: "bytes=5000-", ifRange: `"v1"`},
+		})
+	})
+
+	t.Run("should restart the download if the file changed", func(t *testing.T) {
+		svr, requests := newServer(func(attempt int) string {
+			return `"v` + strconv.Itoa(attempt) + `"`
+		}, 1)
+		defer svr.Close()
+
+		dest := filepath.Join(t.TempDir(), "file")
+
+		client := New(time.Second)
+		err := client.Download(ctx, svr.URL, dest, DownloadOptions{
+			BaseRetryDelay: time.Millisecond,
+			Checksum:       checksum,
+		})
+		tt.AssertNoErr(t, err)
+
+		assertDownloaded(t, dest)
+		tt.AssertEqual(t, requests(), []request{
+			{},
+			{rangeHeader: "bytes=5000-", ifRange: `"v1"`},
+		})
+	})
+
+	t.Run("should resume downloads from previous calls", func(t *testing.T) {
+		svr, requests := newServer(staticETag, 1)
+		defer svr.Close()
+
+		dest := filepath.Join(t.TempDir(), "file")
+
+		client := New(time.Second)
+		err := client.Download(ctx, svr.URL, dest, DownloadOptions{
+			MaxRetries: 1,
+		})
+		tt.AssertErrContains(t, err, "error downloading")
+
+		err = client.Download(ctx, svr.URL, dest, DownloadOptions{
+			Checksum: checksum,
+		})
+		tt.AssertNoErr(t, err)
+
+		assertDownloaded(t, dest)
+		tt.AssertEqual(t, requests(), []request{
+			{},
+			{rangeHeader: "bytes=5000-", ifRange: `"v1"`},
+		})
+	})
+
+	t.Run("should report checksum mismatches", func(t *testing.T) {
+		svr, _ := newServer(staticETag, 0)
+		defer svr.Close()
+
+		dest := filepath.Join(t.TempDir(), "file")
+
+		client := New(time.Second)
+		err := client.Download(ctx, svr.URL, dest, DownloadOptions{
+			Checksum: strings.Repeat("0", 64),
+		})
+		tt.AssertEqual(t, errors.Is(err, ErrChecksumMismatch), true)
+		tt.AssertErrContains(t, err, checksum)
+
+		_, err = os.Stat(dest)
+		tt.AssertEqual(t, os.IsNotExist(err), true)
+		_, err = os.Stat(dest + ".part")
+		tt.AssertEqual(t, os.IsNotExist(err), true)
+	})
+
+	t.Run("should not retry client errors", func(t *testing.T) {
+		var requests int
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer svr.Close()
+
+		dest := filepath.Join(t.TempDir(), "file")
+
+		client := New(time.Second)
+		err := client.Download(ctx, svr.URL, dest, DownloadOptions{})
+		tt.AssertErrContains(t, err, "404")
+		tt.AssertEqual(t, requests, 1)
+
+		_, err = os.Stat(dest)
+		tt.AssertEqual(t, os.IsNotExist(err), true)
+	})
+}
+
+func TestParseContentRange(t *testing.T) {
+	for _, test := range []struct {
+		header string
+
+		expectedStart int64
+		expectedTotal int64
+		expectErr     bool
+	}{
+		{header: "bytes 0-99/100", expectedStart: 0, expectedTotal: 100},
+		{header: "bytes 50-99/*", expectedStart: 50, expectedTotal: -1},
+		{header: "bytes 50-99/99", expectErr: true},
+		{header: "bytes 99-50/100", expectErr: true},
+		{header: "bytes */100", expectErr: true},
+		{header: "items 0-1/2", expectErr: true},
+	} {
+		t.Run(test.header, func(t *testing.T) {
+			start, total, err := parseContentRange(test.header)
+			if test.expectErr {
+				tt.AssertErrContains(t, err, "invalid Content-Range")
+				return
+			}
+			tt.AssertNoErr(t, err)
+			tt.AssertEqual(t, start, test.expectedStart)
+			tt.AssertEqual(t, total, test.expectedTotal)
+		})
+	}
+}
+
+func TestParallelDownload(t *testing.T) {
+	ctx := context.Background()
+
+	randMillis = func() time.Duration {
+		return 0
+	}
+	minDownloadChunkSize = 1000
+	defer func() {
+		randMillis = DefaultRandMillis
+		minDownloadChunkSize = 1024 * 1024
+	}()
+
+	content := []byte(strings.Repeat("0123456789", 1000))
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	t.Run("should download byte ranges in parallel", func(t *testing.T) {
+		var mu sync.Mutex
+		var ranges []string
+		var interrupted bool
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			ranges = append(ranges, r.Method+" "+r.Header.Get("Range"))
+			interrupt := r.Header.Get("Range") == "bytes=2500-4999" && !interrupted
+			interrupted = interrupted || interrupt
+			mu.Unlock()
+
+			tt.AssertEqual(t, r.Header.Get("Authorization"), "Bearer fakeToken")
+			if r.Method == "GET" {
+				tt.AssertEqual(t, r.Header.Get("If-Range"), `"v1"`)
+			}
+
+			w.Header().Set("ETag", `"v1"`)
+			if interrupt {
+				w.Header().Set("Content-Range", "bytes 2500-4999/10000")
+				w.Header().Set("Content-Length", "2500")
+				w.WriteHeader(http.StatusPartialContent)
+				_, _ = w.Write(content[2500:3000])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		}))
+		defer svr.Close()
+
+		dest := filepath.Join(t.TempDir(), "file")
+
+		client := New(time.Second, func(
+			ctx context.Context, method string, url string, data RequestData, next NextMiddleware,
+		) (Response, error) {
+			data.Headers = copyHeaders(data.Headers)
+			data.Headers["Authorization"] = "Bearer fakeToken"
+			return next(ctx, method, url, data)
+		})
+		err := client.Download(ctx, svr.URL, dest, DownloadOptions{
+			Concurrency:    4,
+			BaseRetryDelay: time.Millisecond,
+			Checksum:       checksum,
+		})
+		tt.AssertNoErr(t, err)
+
+		data, err := os.ReadFile(dest)
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, bytes.Equal(data, content), true)
+
+		sort.Strings(ranges)
+		tt.AssertEqual(t, ranges, []string{
+			"GET bytes=0-2499",
+			"GET bytes=2500-4999",
+			"GET bytes=3000-4999",
+			"GET bytes=5000-7499",
+			"GET bytes=7500-9999",
+			"HEAD ",
+		})
+	})
+
+	t.Run("should fall back to a single stream without Accept-Ranges", func(t *testing.T) {
+		var mu sync.Mutex
+		var requests []string
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests = append(requests, r.Method+" "+r.Header.Get("Range"))
+			mu.Unlock()
+
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			if r.Method == "GET" {
+				_, _ = w.Write(content)
+			}
+		}))
+		defer svr.Close()
+
+		dest := filepath.Join(t.TempDir(), "file")
+
+		client := New(time.Second)
+		err := client.Download(ctx, svr.URL, dest, DownloadOptions{
+			Concurrency: 4,
+			Checksum:    checksum,
+		})
+		tt.AssertNoErr(t, err)
+
+		data, err := os.ReadFile(dest)
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, bytes.Equal(data, content), true)
+		tt.AssertEqual(t, requests, []string{"HEAD ", "GET "})
+	})
+
+	t.Run("should fail if the file changes during the download", func(t *testing.T) {
+		var mu sync.Mutex
+		var requests int
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests++
+			etag := `"v1"`
+			if requests > 1 {
+				etag = `"v2"`
+			}
+			mu.Unlock()
+
+			w.Header().Set("ETag", etag)
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		}))
+		defer svr.Close()
+
+		dest := filepath.Join(t.TempDir(), "file")
+
+		client := New(time.Second)
+		err := client.Download(ctx, svr.URL, dest, DownloadOptions{
+			Concurrency: 4,
+		})
+		tt.AssertErrContains(t, err, "expected status 206", "got 200")
+
+		_, err = os.Stat(dest)
+		tt.AssertEqual(t, os.IsNotExist(err), true)
+	})
+}
@@ -0,0 +1,213 @@
+package krest
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const formContentType = "application/x-www-form-urlencoded"
+
+// FormBody is a request body that will be encoded as
+// `application/x-www-form-urlencoded`, see krest.Form() for details.
+type FormBody struct {
+	value interface{}
+}
+
+// Form is a helper for sending structs as `application/x-www-form-urlencoded`
+// request bodies, the fields are named after the `form` struct tag, e.g.:
+//
+//	Body: krest.Form(struct {
+//		GrantType string   `form:"grant_type"`
+//		Scopes    []string `form:"scope,omitempty"`
+//		Internal  string   `form:"-"`
+//	}{...})
+//
+// Fields without the tag use the field name as the key, slices are encoded
+// as repeated keys and nil pointers are omitted. Values of type url.Values
+// can also be passed directly as the request body without this helper.
+func Form(v interface{}) FormBody {
+	return FormBody{
+		value: v,
+	}
+}
+
+// encodeFormBody encodes bodies of type url.Values and FormBody,
+// returning ok=false for any other types.
+func encodeFormBody(body interface{}) (payload []byte, ok bool, err error) {
+	switch body := body.(type) {
+	case url.Values:
+		return []byte(body.Encode()), true, nil
+	case FormBody:
+		values, err := formValues(body.value)
+		if err != nil {
+			return nil, false, fmt.Errorf("error encoding form body: %w", err)
+		}
+		return []byte(values.Encode()), true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func formValues(v interface{}) (url.Values, error) {
+	if values, ok := v.(url.Values); ok {
+		return values, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return url.Values{}, nil
+		}
+		rv = rv.Elem()
+	}
+
+	values := url.Values{}
+	switch rv.Kind() {
+	case reflect.Struct:
+		err := addStructFields(values, rv)
+		if err != nil {
+			return nil, err
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type: %s", rv.Type().Key())
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			err := addFormValue(values, iter.Key().String(), iter.Value())
+			if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("expected a struct or a map but got: %T", v)
+	}
+
+	return values, nil
+}
+
+func addStructFields(values url.Values, rv reflect.Value) error {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			// Ignore unexported fields:
+			continue
+		}
+
+		name, opts := field.Name, ""
+		if tag, ok := field.Tag.Lookup("form"); ok {
+			name = tag
+			if i := strings.Index(tag, ","); i >= 0 {
+				name, opts = tag[:i], tag[i+1:]
+			}
+			if name == "" {
+				// Tags with only options keep the field name, as on encoding/json:
+				name = field.Name
+			}
+		}
+		if name == "-" {
+			continue
+		}
+
+		value := rv.Field(i)
+		if field.Anonymous && name == field.Name && indirectType(field.Type).Kind() == reflect.Struct {
+			// Embedded structs have their fields flattened:
+			for value.Kind() == reflect.Ptr {
+				if value.IsNil() {
+					break
+				}
+				value = value.Elem()
+			}
+			if value.Kind() == reflect.Struct {
+				err := addStructFields(values, value)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if strings.Contains(opts, "omitempty") && value.IsZero() {
+			continue
+		}
+
+		err := addFormValue(values, name, value)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func addFormValue(values url.Values, key string, value reflect.Value) error {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	if (value.Kind() == reflect.Slice || value.Kind() == reflect.Array) && value.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < value.Len(); i++ {
+			err := addFormValue(values, key, value.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	s, err := formatFormValue(value)
+	if err != nil {
+		return err
+	}
+	values.Add(key, s)
+	return nil
+}
+
+func formatFormValue(value reflect.Value) (string, error) {
+	if value.Type() == timeType {
+		return value.Interface().(time.Time).Format(time.RFC3339), nil
+	}
+
+	if value.Type().Implements(textMarshalerType) {
+		text, err := value.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, value.Type().Bits()), nil
+	case reflect.Slice:
+		// Only []byte reaches this point:
+		return string(value.Bytes()), nil
+	default:
+		return "", fmt.Errorf("unsupported form value type: %s", value.Type())
+	}
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,132 @@
+package krest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestFormBodies(t *testing.T) {
+	ctx := context.Background()
+
+	type Embedded struct {
+		Page int `form:"page"`
+	}
+
+	strPtr := func(s string) *string { return &s }
+
+	for _, test := range []struct {
+		desc    string
+		body    interface{}
+		headers map[string]any
+
+		expectedBody        string
+		expectedContentType string
+		expectErrToContain  []string
+	}{
+		{
+			desc: "should encode url.Values",
+			body: url.Values{
+				"grant_type": []string{"client_credentials"},
+				"scope":      []string{"read write"},
+			},
+			expectedBody:        "grant_type=client_credentials&scope=read+write",
+			expectedContentType: "application/x-www-form-urlencoded",
+		},
+		{
+			desc: "should encode structs using the form tags",
+			body: Form(struct {
+				Embedded
+				GrantType  string    `form:"grant_type"`
+				Scopes     []string  `form:"scope"`
+				Optional   string    `form:"optional,omitempty"`
+				Nil        *string   `form:"nil"`
+				Ptr        *string   `form:"ptr"`
+				Ignored    string    `form:"-"`
+				Untagged   bool      ``
+				Since      time.Time `form:"since"`
+				unexported string
+			}{
+				Embedded:   Embedded{Page: 2},
+				GrantType:  "password",
+				Scopes:     []string{"read", "write"},
+				Ptr:        strPtr("fakePtr"),
+				Ignored:    "fakeIgnored",
+				Untagged:   true,
+				Since:      time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+				unexported: "fakeUnexported",
+			}),
+			expectedBody: "Untagged=true&grant_type=password&page=2&ptr=fakePtr" +
+				"&scope=read&scope=write&since=2023-01-02T03%3A04%3A05Z",
+			expectedContentType: "application/x-www-form-urlencoded",
+		},
+		{
+			desc: "should use the field name for tags with only options",
+			body: Form(struct {
+				Name  string `form:",omitempty"`
+				Empty string `form:",omitempty"`
+			}{
+				Name: "fakeName",
+			}),
+			expectedBody:        "Name=fakeName",
+			expectedContentType: "application/x-www-form-urlencoded",
+		},
+		{
+			desc: "should encode maps",
+			body: Form(map[string]interface{}{
+				"ids":  []int{1, 2},
+				"name": "fakeName",
+			}),
+			expectedBody:        "ids=1&ids=2&name=fakeName",
+			expectedContentType: "application/x-www-form-urlencoded",
+		},
+		{
+			desc: "should not override the Content-Type set by the caller",
+			body: url.Values{
+				"key": []string{"value"},
+			},
+			headers: map[string]any{
+				"content-type": "application/x-www-form-urlencoded; charset=utf-8",
+			},
+			expectedBody:        "key=value",
+			expectedContentType: "application/x-www-form-urlencoded; charset=utf-8",
+		},
+		{
+			desc: "should report unsupported field types",
+			body: Form(struct {
+				Channel chan int `form:"channel"`
+			}{Channel: make(chan int)}),
+			expectErrToContain: []string{"form", "Channel", "chan int"},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var requestBody []byte
+			var contentType string
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestBody, _ = io.ReadAll(r.Body)
+				contentType = r.Header.Get("Content-Type")
+			}))
+			defer svr.Close()
+
+			client := New(time.Second)
+			_, err := client.Post(ctx, svr.URL, RequestData{
+				Headers: test.headers,
+				Body:    test.body,
+			})
+			if test.expectErrToContain != nil {
+				tt.AssertErrContains(t, err, test.expectErrToContain...)
+				return
+			}
+			tt.AssertNoErr(t, err)
+
+			tt.AssertEqual(t, string(requestBody), test.expectedBody)
+			tt.AssertEqual(t, contentType, test.expectedContentType)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package krest
+
+import (
+	"net/http"
+	"strings"
+)
+
+// getHeader returns the value of a header from a RequestData.Headers map
+// comparing the keys case-insensitively the same way http.Header does.
+//
+// Headers with multiple values are joined with ", ".
+func getHeader(headers map[string]any, key string) string {
+	for k, value := range headers {
+		if !strings.EqualFold(k, key) {
+			continue
+		}
+
+		switch v := value.(type) {
+		case string:
+			return v
+		case []string:
+			return strings.Join(v, ", ")
+		}
+	}
+	return ""
+}
+
+// setHeader sets a header on a RequestData.Headers map, replacing
+// any other keys that only differ from the input key by case.
+func setHeader(headers map[string]any, key string, value any) {
+	for k := range headers {
+		if strings.EqualFold(k, key) {
+			delete(headers, k)
+		}
+	}
+	headers[http.CanonicalHeaderKey(key)] = value
+}
+
+// copyHeaders returns a shallow copy of a RequestData.Headers map
+// so middlewares can add headers without affecting the caller's map.
+func copyHeaders(headers map[string]any) map[string]any {
+	c := make(map[string]any, len(headers))
+	for k, v := range headers {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,593 @@
+package krest
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MessageSigner describes the signing algorithms
+// used for HTTP Message Signatures (RFC 9421).
+type MessageSigner interface {
+	// Algorithm returns the name of the algorithm as registered on the
+	// HTTP Signature Algorithms registry, e.g. "ed25519"
+	Algorithm() string
+	Sign(signatureBase []byte) ([]byte, error)
+}
+
+// MessageVerifier describes the verification algorithms
+// used for HTTP Message Signatures (RFC 9421).
+type MessageVerifier interface {
+	Algorithm() string
+	Verify(signatureBase []byte, signature []byte) error
+}
+
+// MessageSignatureConfig describes the configurations
+// of the HTTP Message Signatures middleware.
+type MessageSignatureConfig struct {
+	// Label identifies the signature on the `Signature-Input` and
+	// `Signature` headers, if unset it defaults to "sig1".
+	Label string
+
+	KeyID  string
+	Signer MessageSigner
+
+	// Components lists the derived components (e.g. "@method" or "@target-uri")
+	// and the lowercased header names that will be signed, if unset it defaults
+	// to "@method", "@target-uri" and "content-digest" when there is a body
+	// that can be buffered, i.e. streamed bodies are not covered by default.
+	//
+	// If "content-digest" is listed and the request has no such header
+	// a sha-256 digest of the body is computed and added to the request.
+	Components []string
+
+	// Tag is an optional application specific tag for the signature
+	Tag string
+
+	// Expiration sets the `expires` parameter relative to the signing time
+	Expiration time.Duration
+}
+
+// NewMessageSignatureMiddleware returns a middleware that signs requests using
+// HTTP Message Signatures (RFC 9421), adding the `Signature-Input` and
+// `Signature` headers to the request.
+func NewMessageSignatureMiddleware(config MessageSignatureConfig) Middleware {
+	return newMessageSignatureMiddleware(config, time.Now)
+}
+
+func newMessageSignatureMiddleware(config MessageSignatureConfig, now func() time.Time) Middleware {
+	if config.Label == "" {
+		config.Label = "sig1"
+	}
+
+	return func(
+		ctx context.Context,
+		method string,
+		rawURL string,
+		data RequestData,
+		next NextMiddleware,
+	) (Response, error) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return Response{}, fmt.Errorf("unable to parse url for signing request: %w", err)
+		}
+
+		components := config.Components
+		if components == nil {
+			components = []string{"@method", "@target-uri"}
+			if data.Body != nil && !isStreamedBody(data.Body) {
+				components = append(components, "content-digest")
+			}
+		}
+
+		data.Headers = copyHeaders(data.Headers)
+		if containsString(components, "content-digest") && getHeader(data.Headers, "Content-Digest") == "" {
+			payload, ok, err := bufferBody(&data)
+			if err != nil {
+				return Response{}, err
+			}
+			if !ok {
+				return Response{}, fmt.Errorf("can't sign the content-digest of a streamed body")
+			}
+			digest, err := computeDigest(DigestSHA256, payload)
+			if err != nil {
+				return Response{}, err
+			}
+			setHeader(data.Headers, "Content-Digest", digest)
+		}
+
+		created := now()
+		params := signatureParams{
+			components: components,
+			created:    created.Unix(),
+			keyID:      config.KeyID,
+			alg:        config.Signer.Algorithm(),
+			tag:        config.Tag,
+		}
+		if config.Expiration > 0 {
+			params.expires = created.Add(config.Expiration).Unix()
+		}
+
+		base, err := signatureBase(params, requestComponentValue(method, u, data.Headers))
+		if err != nil {
+			return Response{}, err
+		}
+
+		signature, err := config.Signer.Sign([]byte(base))
+		if err != nil {
+			return Response{}, fmt.Errorf("error signing request: %w", err)
+		}
+
+		setHeader(data.Headers, "Signature-Input", config.Label+"="+params.String())
+		setHeader(data.Headers, "Signature", config.Label+"=:"+base64.StdEncoding.EncodeToString(signature)+":")
+
+		return next(ctx, method, rawURL, data)
+	}
+}
+
+// SignatureVerification describes the rules
+// for verifying a signed response.
+type SignatureVerification struct {
+	// Label selects which signature to verify,
+	// if unset the first signature is used.
+	Label string
+
+	Verifier MessageVerifier
+
+	// RequiredComponents lists the components that must
+	// be covered by the signature, e.g. "@status" or "content-digest".
+	RequiredComponents []string
+
+	// MaxAge rejects signatures created longer than MaxAge ago, if 0 it is not checked.
+	MaxAge time.Duration
+}
+
+// VerifyResponseSignature validates the HTTP Message Signature (RFC 9421)
+// of a response, returning an error if the signature is missing or invalid.
+//
+// Only the "@status" derived component and header fields
+// are supported on response signatures.
+//
+// If the signature covers the "content-digest" the digest is also checked
+// against resp.Body. Since the body of streamed responses is not available
+// at this point only the header is covered for them, so in that case use
+// RequestData.VerifyResponseDigest for verifying the body as it is read.
+func VerifyResponseSignature(resp Response, rules SignatureVerification) error {
+	return verifyResponseSignature(resp, rules, time.Now())
+}
+
+func verifyResponseSignature(resp Response, rules SignatureVerification, now time.Time) error {
+	label, rawParams, err := findDictionaryMember(resp.Headers.Values("Signature-Input"), rules.Label)
+	if err != nil {
+		return fmt.Errorf("invalid Signature-Input header: %w", err)
+	}
+
+	_, rawSignature, err := findDictionaryMember(resp.Headers.Values("Signature"), label)
+	if err != nil {
+		return fmt.Errorf("invalid Signature header: %w", err)
+	}
+	if len(rawSignature) < 2 || rawSignature[0] != ':' || rawSignature[len(rawSignature)-1] != ':' {
+		return fmt.Errorf("invalid Signature header: expected a byte sequence for label '%s'", label)
+	}
+	signature, err := base64.StdEncoding.DecodeString(rawSignature[1 : len(rawSignature)-1])
+	if err != nil {
+		return fmt.Errorf("invalid Signature header: %w", err)
+	}
+
+	params, err := parseSignatureParams(rawParams)
+	if err != nil {
+		return fmt.Errorf("invalid Signature-Input header: %w", err)
+	}
+
+	for _, required := range rules.RequiredComponents {
+		if !containsString(params.components, required) {
+			return fmt.Errorf("signature '%s' does not cover the required component '%s'", label, required)
+		}
+	}
+	if params.alg != "" && params.alg != rules.Verifier.Algorithm() {
+		return fmt.Errorf("signature '%s' uses algorithm '%s' but expected '%s'", label, params.alg, rules.Verifier.Algorithm())
+	}
+	if params.expires != 0 && now.Unix() > params.expires {
+		return fmt.Errorf("signature '%s' has expired", label)
+	}
+	if rules.MaxAge > 0 && now.Sub(time.Unix(params.created, 0)) > rules.MaxAge {
+		return fmt.Errorf("signature '%s' is older than the max age of %s", label, rules.MaxAge)
+	}
+
+	params.raw = rawParams
+	base, err := signatureBase(params, responseComponentValue(resp))
+	if err != nil {
+		return err
+	}
+
+	err = rules.Verifier.Verify([]byte(base), signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature '%s': %w", label, err)
+	}
+
+	if containsString(params.components, "content-digest") && !resp.streamed {
+		return verifySignedContentDigest(resp)
+	}
+
+	return nil
+}
+
+func verifySignedContentDigest(resp Response) error {
+	if resp.ContentEncoding != "" {
+		return fmt.Errorf(
+			"can't verify the signed content-digest of a decompressed body, use RequestData.DisableDecompression",
+		)
+	}
+
+	digest, err := parseDigestHeader(resp.Headers, "Content-Digest")
+	if err != nil {
+		return err
+	}
+	if digest == nil {
+		return fmt.Errorf("the signed Content-Digest header has no supported algorithms")
+	}
+
+	return verifyDigests([]expectedDigest{*digest}, resp.Body)
+}
+
+type signatureParams struct {
+	components []string
+	created    int64
+	expires    int64
+	keyID      string
+	alg        string
+	tag        string
+
+	// raw holds the params exactly as received when verifying a signature
+	raw string
+}
+
+// String serializes the params as an inner list as described on RFC 9421 section 2.3
+func (p signatureParams) String() string {
+	if p.raw != "" {
+		return p.raw
+	}
+
+	quoted := make([]string, len(p.components))
+	for i, c := range p.components {
+		quoted[i] = strconv.Quote(c)
+	}
+
+	s := "(" + strings.Join(quoted, " ") + ")"
+	if p.created != 0 {
+		s += ";created=" + strconv.FormatInt(p.created, 10)
+	}
+	if p.expires != 0 {
+		s += ";expires=" + strconv.FormatInt(p.expires, 10)
+	}
+	if p.keyID != "" {
+		s += ";keyid=" + strconv.Quote(p.keyID)
+	}
+	if p.alg != "" {
+		s += ";alg=" + strconv.Quote(p.alg)
+	}
+	if p.tag != "" {
+		s += ";tag=" + strconv.Quote(p.tag)
+	}
+	return s
+}
+
+// signatureBase builds the signature base as described on RFC 9421 section 2.5
+func signatureBase(params signatureParams, componentValue func(name string) (string, error)) (string, error) {
+	var base strings.Builder
+	for _, name := range params.components {
+		value, err := componentValue(name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&base, "%q: %s\n", name, value)
+	}
+	fmt.Fprintf(&base, "%q: %s", "@signature-params", params.String())
+	return base.String(), nil
+}
+
+func requestComponentValue(method string, u *url.URL, headers map[string]any) func(name string) (string, error) {
+	return func(name string) (string, error) {
+		switch name {
+		case "@method":
+			return strings.ToUpper(method), nil
+		case "@target-uri":
+			return u.String(), nil
+		case "@authority":
+			return strings.ToLower(u.Host), nil
+		case "@scheme":
+			return strings.ToLower(u.Scheme), nil
+		case "@request-target":
+			return u.RequestURI(), nil
+		case "@path":
+			if u.EscapedPath() == "" {
+				return "/", nil
+			}
+			return u.EscapedPath(), nil
+		case "@query":
+			return "?" + u.RawQuery, nil
+		}
+
+		if strings.HasPrefix(name, "@") {
+			return "", fmt.Errorf("unsupported derived component for requests: %s", name)
+		}
+
+		value := getHeader(headers, name)
+		if value == "" {
+			return "", fmt.Errorf("can't sign missing header '%s'", name)
+		}
+		return strings.TrimSpace(value), nil
+	}
+}
+
+func responseComponentValue(resp Response) func(name string) (string, error) {
+	return func(name string) (string, error) {
+		if name == "@status" {
+			return strconv.Itoa(resp.StatusCode), nil
+		}
+
+		if strings.HasPrefix(name, "@") {
+			return "", fmt.Errorf("unsupported derived component for responses: %s", name)
+		}
+
+		values := resp.Headers.Values(name)
+		if len(values) == 0 {
+			return "", fmt.Errorf("signed header '%s' is missing from the response", name)
+		}
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		return strings.Join(values, ", "), nil
+	}
+}
+
+// findDictionaryMember finds a member of a structured field dictionary
+// returning its raw value, if label is empty the first member is returned.
+func findDictionaryMember(headerValues []string, label string) (foundLabel string, value string, _ error) {
+	for _, member := range splitOutsideQuotes(strings.Join(headerValues, ","), ',') {
+		member = strings.TrimSpace(member)
+		i := strings.Index(member, "=")
+		if i < 0 {
+			continue
+		}
+
+		if label == "" || member[:i] == label {
+			return member[:i], member[i+1:], nil
+		}
+	}
+
+	if label == "" {
+		return "", "", fmt.Errorf("no signatures found")
+	}
+	return "", "", fmt.Errorf("signature '%s' not found", label)
+}
+
+// parseSignatureParams parses an inner list like:
+//
+//	("@status" "content-digest");created=1618884473;keyid="test-key"
+func parseSignatureParams(raw string) (signatureParams, error) {
+	end := strings.Index(raw, ")")
+	if !strings.HasPrefix(raw, "(") || end < 0 {
+		return signatureParams{}, fmt.Errorf("expected an inner list but got: %s", raw)
+	}
+
+	var params signatureParams
+	for _, item := range strings.Fields(raw[1:end]) {
+		component, err := strconv.Unquote(item)
+		if err != nil {
+			return signatureParams{}, fmt.Errorf("unsupported component identifier: %s", item)
+		}
+		params.components = append(params.components, component)
+	}
+
+	for _, param := range splitOutsideQuotes(raw[end+1:], ';') {
+		if param == "" {
+			continue
+		}
+
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return signatureParams{}, fmt.Errorf("invalid signature parameter: %s", param)
+		}
+
+		var err error
+		switch kv[0] {
+		case "created":
+			params.created, err = strconv.ParseInt(kv[1], 10, 64)
+		case "expires":
+			params.expires, err = strconv.ParseInt(kv[1], 10, 64)
+		case "keyid":
+			params.keyID, err = strconv.Unquote(kv[1])
+		case "alg":
+			params.alg, err = strconv.Unquote(kv[1])
+		case "tag":
+			params.tag, err = strconv.Unquote(kv[1])
+		}
+		if err != nil {
+			return signatureParams{}, fmt.Errorf("invalid signature parameter: %s", param)
+		}
+	}
+
+	return params, nil
+}
+
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	var inQuotes bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && inQuotes:
+			i++
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NewEd25519Signer returns a MessageSigner for the "ed25519" algorithm
+func NewEd25519Signer(key ed25519.PrivateKey) MessageSigner {
+	return ed25519Algorithm{privateKey: key}
+}
+
+// NewEd25519Verifier returns a MessageVerifier for the "ed25519" algorithm
+func NewEd25519Verifier(key ed25519.PublicKey) MessageVerifier {
+	return ed25519Algorithm{publicKey: key}
+}
+
+type ed25519Algorithm struct {
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+func (a ed25519Algorithm) Algorithm() string {
+	return "ed25519"
+}
+
+func (a ed25519Algorithm) Sign(base []byte) ([]byte, error) {
+	return ed25519.Sign(a.privateKey, base), nil
+}
+
+func (a ed25519Algorithm) Verify(base []byte, signature []byte) error {
+	if !ed25519.Verify(a.publicKey, base, signature) {
+		return fmt.Errorf("ed25519 verification failed")
+	}
+	return nil
+}
+
+// NewRSAPSSSigner returns a MessageSigner for the "rsa-pss-sha512" algorithm
+func NewRSAPSSSigner(key *rsa.PrivateKey) MessageSigner {
+	return rsaPSSAlgorithm{privateKey: key}
+}
+
+// NewRSAPSSVerifier returns a MessageVerifier for the "rsa-pss-sha512" algorithm
+func NewRSAPSSVerifier(key *rsa.PublicKey) MessageVerifier {
+	return rsaPSSAlgorithm{publicKey: key}
+}
+
+type rsaPSSAlgorithm struct {
+	privateKey *rsa.PrivateKey
+	publicKey  *rsa.PublicKey
+}
+
+var rsaPSSOptions = &rsa.PSSOptions{
+	SaltLength: 64,
+	Hash:       crypto.SHA512,
+}
+
+func (a rsaPSSAlgorithm) Algorithm() string {
+	return "rsa-pss-sha512"
+}
+
+func (a rsaPSSAlgorithm) Sign(base []byte) ([]byte, error) {
+	hash := sha512.Sum512(base)
+	return rsa.SignPSS(rand.Reader, a.privateKey, crypto.SHA512, hash[:], rsaPSSOptions)
+}
+
+func (a rsaPSSAlgorithm) Verify(base []byte, signature []byte) error {
+	hash := sha512.Sum512(base)
+	return rsa.VerifyPSS(a.publicKey, crypto.SHA512, hash[:], signature, rsaPSSOptions)
+}
+
+// NewECDSAP256Signer returns a MessageSigner for the "ecdsa-p256-sha256" algorithm
+func NewECDSAP256Signer(key *ecdsa.PrivateKey) MessageSigner {
+	return ecdsaP256Algorithm{privateKey: key}
+}
+
+// NewECDSAP256Verifier returns a MessageVerifier for the "ecdsa-p256-sha256" algorithm
+func NewECDSAP256Verifier(key *ecdsa.PublicKey) MessageVerifier {
+	return ecdsaP256Algorithm{publicKey: key}
+}
+
+type ecdsaP256Algorithm struct {
+	privateKey *ecdsa.PrivateKey
+	publicKey  *ecdsa.PublicKey
+}
+
+func (a ecdsaP256Algorithm) Algorithm() string {
+	return "ecdsa-p256-sha256"
+}
+
+// Sign encodes the signature as the concatenation of the r and s
+// values as required by RFC 9421 instead of the usual ASN.1 format.
+func (a ecdsaP256Algorithm) Sign(base []byte) ([]byte, error) {
+	hash := sha256.Sum256(base)
+	r, s, err := ecdsa.Sign(rand.Reader, a.privateKey, hash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signature, nil
+}
+
+func (a ecdsaP256Algorithm) Verify(base []byte, signature []byte) error {
+	if len(signature) != 64 {
+		return fmt.Errorf("invalid ecdsa-p256-sha256 signature length: %d", len(signature))
+	}
+
+	hash := sha256.Sum256(base)
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(a.publicKey, hash[:], r, s) {
+		return fmt.Errorf("ecdsa-p256-sha256 verification failed")
+	}
+	return nil
+}
+
+// NewHMACSHA256Signer returns a MessageSigner for the "hmac-sha256" algorithm
+func NewHMACSHA256Signer(key []byte) MessageSigner {
+	return hmacSHA256Algorithm{key: key}
+}
+
+// NewHMACSHA256Verifier returns a MessageVerifier for the "hmac-sha256" algorithm
+func NewHMACSHA256Verifier(key []byte) MessageVerifier {
+	return hmacSHA256Algorithm{key: key}
+}
+
+type hmacSHA256Algorithm struct {
+	key []byte
+}
+
+func (a hmacSHA256Algorithm) Algorithm() string {
+	return "hmac-sha256"
+}
+
+func (a hmacSHA256Algorithm) Sign(base []byte) ([]byte, error) {
+	return hmacSHA256(a.key, base), nil
+}
+
+func (a hmacSHA256Algorithm) Verify(base []byte, signature []byte) error {
+	if !hmac.Equal(hmacSHA256(a.key, base), signature) {
+		return fmt.Errorf("hmac-sha256 verification failed")
+	}
+	return nil
+}
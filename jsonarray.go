@@ -0,0 +1,208 @@
+package krest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// JSONArrayIterator decodes the elements of a JSON array
+// one at a time, see krest.JSONArray() for details.
+type JSONArrayIterator[T any] struct {
+	ctx     context.Context
+	body    *streamBody
+	decoder *json.Decoder
+	path    []string
+
+	started bool
+	index   int
+	value   T
+	err     error
+}
+
+// JSONArray returns an iterator that decodes the elements of the JSON array
+// found at the input path of the response body into values of type T, e.g.
+// for the body `{"data": {"items": [...]}}` the path would be "data", "items":
+//
+//	items := krest.JSONArray[Item](ctx, resp, "data", "items")
+//	defer items.Close()
+//	for items.Next() {
+//		item := items.Value()
+//		// ...
+//	}
+//	if err := items.Err(); err != nil {
+//		// ...
+//	}
+//
+// If no path is passed the body itself is expected to be an array. Only a
+// single element is kept in memory at a time, and the rest of the body after
+// the array is not read. Like krest.NDJSON() the body is closed when the
+// iteration ends, when the context is canceled or when Close() is called.
+//
+// It should be used along with the Stream option,
+// otherwise the whole body is loaded into memory first.
+func JSONArray[T any](ctx context.Context, resp Response, path ...string) *JSONArrayIterator[T] {
+	body := newStreamBody(ctx, resp.ReadCloser)
+	return &JSONArrayIterator[T]{
+		ctx:     ctx,
+		body:    body,
+		decoder: json.NewDecoder(body),
+		path:    path,
+		index:   -1,
+	}
+}
+
+// Next decodes the next element, returning false when there are no more
+// elements or if an error occurred, in which case it is returned by Err().
+func (it *JSONArrayIterator[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	if !it.started {
+		it.started = true
+		err := it.seekArray()
+		if err != nil {
+			it.fail(err)
+			return false
+		}
+	}
+
+	if !it.decoder.More() {
+		// Consume the closing bracket so syntax errors are reported:
+		_, err := it.decoder.Token()
+		if err != nil {
+			it.fail(it.wrapErr(err))
+			return false
+		}
+		it.fail(io.EOF)
+		return false
+	}
+
+	var value T
+	err := it.decoder.Decode(&value)
+	if err != nil {
+		it.fail(it.wrapErr(fmt.Errorf("error decoding element %d: %w", it.index+1, err)))
+		return false
+	}
+
+	it.index++
+	it.value = value
+	return true
+}
+
+// Value returns the element decoded by the last call to Next()
+func (it *JSONArrayIterator[T]) Value() T {
+	return it.value
+}
+
+// Index returns the position of the last element read, starting from 0
+func (it *JSONArrayIterator[T]) Index() int {
+	return it.index
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *JSONArrayIterator[T]) Err() error {
+	if it.err == io.EOF {
+		return nil
+	}
+	return it.err
+}
+
+// Close closes the response body, it is safe to call it more than once
+func (it *JSONArrayIterator[T]) Close() error {
+	return it.body.Close()
+}
+
+func (it *JSONArrayIterator[T]) fail(err error) {
+	it.err = err
+	_ = it.Close()
+}
+
+func (it *JSONArrayIterator[T]) wrapErr(err error) error {
+	if it.ctx.Err() != nil {
+		return it.ctx.Err()
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("error reading JSON array at path '%s': %w", strings.Join(it.path, "."), err)
+}
+
+// seekArray reads the body up to the opening bracket of the
+// array at it.path, skipping any other values on the way.
+func (it *JSONArrayIterator[T]) seekArray() error {
+	for i, key := range it.path {
+		err := it.expectDelim('{', it.path[:i])
+		if err != nil {
+			return err
+		}
+
+		for {
+			if !it.decoder.More() {
+				return it.wrapErr(fmt.Errorf("key '%s' not found", key))
+			}
+
+			token, err := it.decoder.Token()
+			if err != nil {
+				return it.wrapErr(err)
+			}
+
+			if token == key {
+				break
+			}
+
+			err = skipJSONValue(it.decoder)
+			if err != nil {
+				return it.wrapErr(err)
+			}
+		}
+	}
+
+	return it.expectDelim('[', it.path)
+}
+
+func (it *JSONArrayIterator[T]) expectDelim(delim json.Delim, path []string) error {
+	token, err := it.decoder.Token()
+	if err != nil {
+		return it.wrapErr(err)
+	}
+
+	if token != delim {
+		kind := "an object"
+		if delim == '[' {
+			kind = "an array"
+		}
+		return it.wrapErr(fmt.Errorf(
+			"expected value at '%s' to be %s but got: %v",
+			strings.Join(path, "."), kind, token,
+		))
+	}
+
+	return nil
+}
+
+// skipJSONValue skips the next value on the decoder without
+// buffering it, which matters for big objects or arrays.
+func skipJSONValue(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+
+		if depth == 0 {
+			return nil
+		}
+	}
+}
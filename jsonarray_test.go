@@ -0,0 +1,130 @@
+package krest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestJSONArray(t *testing.T) {
+	ctx := context.Background()
+
+	type item struct {
+		ID int `json:"id"`
+	}
+
+	for _, test := range []struct {
+		desc string
+		body string
+		path []string
+
+		expectedItems      []item
+		expectErrToContain []string
+	}{
+		{
+			desc:          "should decode root arrays",
+			body:          `[{"id":1},{"id":2}]`,
+			expectedItems: []item{{ID: 1}, {ID: 2}},
+		},
+		{
+			desc:          "should decode empty arrays",
+			body:          `{"items":[]}`,
+			path:          []string{"items"},
+			expectedItems: nil,
+		},
+		{
+			desc: "should decode nested arrays skipping other values",
+			body: `{
+				"meta": {"total": 2, "tags": ["a", {"b": [1, 2]}]},
+				"count": 2,
+				"data": {"cursor": null, "items": [{"id":1}, {"id":2}], "after": "ignored"}
+			}`,
+			path:          []string{"data", "items"},
+			expectedItems: []item{{ID: 1}, {ID: 2}},
+		},
+		{
+			desc:               "should report missing keys",
+			body:               `{"data": {"other": []}}`,
+			path:               []string{"data", "items"},
+			expectErrToContain: []string{"data.items", "key 'items' not found"},
+		},
+		{
+			desc:               "should report values that are not arrays",
+			body:               `{"items": {"id": 1}}`,
+			path:               []string{"items"},
+			expectErrToContain: []string{"expected value at 'items' to be an array"},
+		},
+		{
+			desc:               "should report invalid elements with their index",
+			body:               `{"items": [{"id":1}, {"id":"invalid"}]}`,
+			path:               []string{"items"},
+			expectedItems:      []item{{ID: 1}},
+			expectErrToContain: []string{"element 1"},
+		},
+		{
+			desc:               "should report truncated bodies",
+			body:               `{"items": [{"id":1}`,
+			path:               []string{"items"},
+			expectedItems:      []item{{ID: 1}},
+			expectErrToContain: []string{"unexpected end"},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			body := &fakeReadCloser{Reader: strings.NewReader(test.body)}
+
+			items := JSONArray[item](ctx, Response{ReadCloser: body}, test.path...)
+			defer items.Close()
+
+			var got []item
+			for items.Next() {
+				got = append(got, items.Value())
+			}
+
+			if test.expectErrToContain != nil {
+				tt.AssertErrContains(t, items.Err(), test.expectErrToContain...)
+			} else {
+				tt.AssertNoErr(t, items.Err())
+			}
+			tt.AssertEqual(t, got, test.expectedItems)
+			tt.AssertEqual(t, body.closed, true)
+		})
+	}
+
+	t.Run("should stream elements from the server", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, `{"items": [`)
+			for i := 0; i < 1000; i++ {
+				if i > 0 {
+					_, _ = fmt.Fprint(w, ",")
+				}
+				_, _ = fmt.Fprintf(w, `{"id":%d}`, i)
+			}
+			_, _ = fmt.Fprint(w, `]}`)
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		resp, err := client.Get(ctx, svr.URL, RequestData{
+			Stream: true,
+		})
+		tt.AssertNoErr(t, err)
+
+		items := JSONArray[item](ctx, resp, "items")
+		defer items.Close()
+
+		var count int
+		for items.Next() {
+			tt.AssertEqual(t, items.Value().ID, count)
+			tt.AssertEqual(t, items.Index(), count)
+			count++
+		}
+		tt.AssertNoErr(t, items.Err())
+		tt.AssertEqual(t, count, 1000)
+	})
+}
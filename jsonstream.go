@@ -0,0 +1,128 @@
+package krest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ItemIterator returns the items of a streamed request body one at a time,
+// returning ok=false when there are no more items.
+type ItemIterator[T any] func() (item T, ok bool, err error)
+
+// FromChannel adapts a channel into an ItemIterator,
+// the iteration ends when the channel is closed.
+func FromChannel[T any](ch <-chan T) ItemIterator[T] {
+	return func() (T, bool, error) {
+		item, ok := <-ch
+		return item, ok, nil
+	}
+}
+
+// FromSlice adapts a slice into an ItemIterator
+func FromSlice[T any](items []T) ItemIterator[T] {
+	return func() (item T, ok bool, err error) {
+		if len(items) == 0 {
+			return item, false, nil
+		}
+		item, items = items[0], items[1:]
+		return item, true, nil
+	}
+}
+
+// JSONStreamBody is a request body that encodes its items lazily while
+// the request is sent, see krest.NDJSONBody() and krest.JSONArrayBody().
+//
+// Since its size is unknown in advance it is sent using chunked transfer
+// encoding, and like any other io.Reader body it can't be retried.
+type JSONStreamBody struct {
+	next        func() (interface{}, bool, error)
+	contentType string
+	array       bool
+
+	buf     bytes.Buffer
+	started bool
+	done    bool
+}
+
+// NDJSONBody creates a request body that encodes each item as a line of JSON,
+// sent with the `application/x-ndjson` Content-Type, e.g.:
+//
+//	Body: krest.NDJSONBody(krest.FromChannel(records)),
+func NDJSONBody[T any](items ItemIterator[T]) *JSONStreamBody {
+	return newJSONStreamBody(items, "application/x-ndjson", false)
+}
+
+// JSONArrayBody creates a request body that encodes the items as a single
+// JSON array, sent with the `application/json` Content-Type, e.g.:
+//
+//	Body: krest.JSONArrayBody(krest.FromChannel(records)),
+func JSONArrayBody[T any](items ItemIterator[T]) *JSONStreamBody {
+	return newJSONStreamBody(items, "application/json", true)
+}
+
+func newJSONStreamBody[T any](items ItemIterator[T], contentType string, array bool) *JSONStreamBody {
+	return &JSONStreamBody{
+		next: func() (interface{}, bool, error) {
+			return items()
+		},
+		contentType: contentType,
+		array:       array,
+	}
+}
+
+// ContentType returns the Content-Type header sent with this body
+func (j *JSONStreamBody) ContentType() string {
+	return j.contentType
+}
+
+// Read implements the io.Reader interface
+func (j *JSONStreamBody) Read(p []byte) (int, error) {
+	for j.buf.Len() == 0 {
+		if j.done {
+			return 0, io.EOF
+		}
+
+		err := j.encodeNext()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return j.buf.Read(p)
+}
+
+func (j *JSONStreamBody) encodeNext() error {
+	if j.array && !j.started {
+		j.buf.WriteByte('[')
+	}
+
+	item, ok, err := j.next()
+	if err != nil {
+		return fmt.Errorf("error reading next item of the request body: %w", err)
+	}
+	if !ok {
+		if j.array {
+			j.buf.WriteByte(']')
+		}
+		j.done = true
+		return nil
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("error encoding item of the request body as JSON: %w", err)
+	}
+
+	if j.array && j.started {
+		j.buf.WriteByte(',')
+	}
+	j.buf.Write(data)
+	if !j.array {
+		j.buf.WriteByte('\n')
+	}
+
+	j.started = true
+	return nil
+}
@@ -0,0 +1,107 @@
+package krest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestJSONStreamBody(t *testing.T) {
+	ctx := context.Background()
+
+	type record struct {
+		ID int `json:"id"`
+	}
+
+	records := func(n int) <-chan record {
+		ch := make(chan record)
+		go func() {
+			defer close(ch)
+			for i := 1; i <= n; i++ {
+				ch <- record{ID: i}
+			}
+		}()
+		return ch
+	}
+
+	for _, test := range []struct {
+		desc    string
+		body    *JSONStreamBody
+		headers map[string]any
+
+		expectedBody        string
+		expectedContentType string
+	}{
+		{
+			desc:                "should encode NDJSON bodies",
+			body:                NDJSONBody(FromChannel(records(3))),
+			expectedBody:        "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n",
+			expectedContentType: "application/x-ndjson",
+		},
+		{
+			desc:                "should encode JSON array bodies",
+			body:                JSONArrayBody(FromChannel(records(3))),
+			expectedBody:        `[{"id":1},{"id":2},{"id":3}]`,
+			expectedContentType: "application/json",
+		},
+		{
+			desc:                "should encode empty JSON arrays",
+			body:                JSONArrayBody(FromSlice([]record{})),
+			expectedBody:        `[]`,
+			expectedContentType: "application/json",
+		},
+		{
+			desc: "should not override the Content-Type set by the caller",
+			body: NDJSONBody(FromSlice([]record{{ID: 1}})),
+			headers: map[string]any{
+				"Content-Type": "application/jsonl",
+			},
+			expectedBody:        "{\"id\":1}\n",
+			expectedContentType: "application/jsonl",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var requestBody []byte
+			var contentType string
+			var transferEncoding []string
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestBody, _ = io.ReadAll(r.Body)
+				contentType = r.Header.Get("Content-Type")
+				transferEncoding = r.TransferEncoding
+			}))
+			defer svr.Close()
+
+			client := New(time.Second)
+			_, err := client.Post(ctx, svr.URL, RequestData{
+				Headers: test.headers,
+				Body:    test.body,
+			})
+			tt.AssertNoErr(t, err)
+
+			tt.AssertEqual(t, string(requestBody), test.expectedBody)
+			tt.AssertEqual(t, contentType, test.expectedContentType)
+			tt.AssertEqual(t, transferEncoding, []string{"chunked"})
+		})
+	}
+
+	t.Run("should report errors from the iterator", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.ReadAll(r.Body)
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		_, err := client.Post(ctx, svr.URL, RequestData{
+			Body: NDJSONBody(func() (record, bool, error) {
+				return record{}, false, errors.New("fakeIteratorErr")
+			}),
+		})
+		tt.AssertErrContains(t, err, "fakeIteratorErr")
+	})
+}
@@ -3,9 +3,9 @@ package krest
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"strings"
@@ -19,6 +19,10 @@ import (
 type Client struct {
 	timeout     time.Duration
 	middlewares []Middleware
+	codecs      []Codec
+
+	decompressors    map[string]Decompressor
+	maxResponseBytes int64
 }
 
 // New instantiates a new rest client
@@ -116,7 +120,9 @@ func (c Client) makeRequestWithMiddlewares(
 		}
 	}
 
-	return middlewareChain(ctx, method, url, data)
+	resp, err := middlewareChain(ctx, method, url, data)
+	resp.codecs = c.codecs
+	return resp, err
 }
 
 func (c Client) makeRequest(
@@ -127,8 +133,13 @@ func (c Client) makeRequest(
 ) (_ Response, err error) {
 	data.SetDefaultsIfNecessary()
 
+	// Copy the headers so we don't modify the map owned by the caller:
+	data.Headers = copyHeaders(data.Headers)
+
 	var bytesPayload []byte
 	var requestBody io.Reader
+	var reopenBody func() (io.Reader, error)
+	contentLength := int64(-1)
 	switch body := data.Body.(type) {
 	case nil:
 		requestBody = nil
@@ -137,33 +148,91 @@ func (c Client) makeRequest(
 			return Response{}, fmt.Errorf("can't retry a request whose body is an io.Reader")
 		}
 
+		if typed, ok := body.(interface{ ContentType() string }); ok && getHeader(data.Headers, "Content-Type") == "" {
+			data.Headers["Content-Type"] = typed.ContentType()
+		}
 		requestBody = body
 	case []byte:
 		bytesPayload = body
 	case string:
 		bytesPayload = []byte(body)
-	case map[string]io.Reader:
-		if data.MaxRetries > 1 {
-			return Response{}, fmt.Errorf("can't retry a request whose body depends on io.Reader's")
+	case map[string]io.Reader, MultipartForm:
+		parts, ok := body.(MultipartForm)
+		if !ok {
+			parts = multipartFormFromMap(body.(map[string]io.Reader))
+		}
+
+		if data.MaxRetries > 1 && !isReplayableForm(parts) {
+			return Response{}, fmt.Errorf(
+				"can't retry a request whose body depends on io.Reader's, use krest.MultipartFilePath()," +
+					" krest.MultipartReaderAt() or krest.MultipartOpener() for the parts instead",
+			)
 		}
 
-		form, contentType, err := newMultipartStream(MultipartData(body))
+		form, contentType, err := newMultipartStream(parts)
 		if err != nil {
 			return Response{}, fmt.Errorf("error building multipart data: %v", err)
 		}
 		data.Headers["Content-Type"] = contentType
 		requestBody = form
+
+		// Each attempt needs a new stream, reusing the boundary of the first one
+		// since it is part of the Content-Type header:
+		boundary := form.multipartWriter.Boundary()
+		if size, ok := multipartContentLength(parts, boundary); ok {
+			contentLength = size
+		}
+		reopenBody = func() (io.Reader, error) {
+			form, _, err := newMultipartStream(parts)
+			if err != nil {
+				return nil, err
+			}
+			return form, form.multipartWriter.SetBoundary(boundary)
+		}
 	default:
-		bytesPayload, err = json.Marshal(data.Body)
+		bytesPayload, err = marshalBody(&data)
+		if err != nil {
+			return Response{}, err
+		}
+	}
+
+	compressStream := false
+	if shouldCompress(&data) && requestBody != nil {
+		// Streamed bodies have unknown sizes so they are always compressed:
+		compressStream = true
+		setHeader(data.Headers, "Content-Encoding", data.CompressBody.ContentEncoding())
+	} else if bytesPayload != nil {
+		bytesPayload, err = compressPayload(&data, bytesPayload)
+		if err != nil {
+			return Response{}, err
+		}
+	}
+
+	if data.ContentDigest != "" && requestBody == nil && getHeader(data.Headers, "Content-Digest") == "" {
+		digest, err := computeDigest(data.ContentDigest, bytesPayload)
 		if err != nil {
 			return Response{}, err
 		}
+		data.Headers["Content-Digest"] = digest
+	}
+
+	// The transport decompresses gzip responses on its own when it sets the
+	// `Accept-Encoding` header, removing the encoded bytes the digests refer to
+	// and the body the caller asked for when disabling the decompression, so in
+	// the first case we ask for gzip ourselves using the same rules it does:
+	disableTransportDecompression := data.VerifyResponseDigest || data.DisableDecompression
+	if data.VerifyResponseDigest && !data.DisableDecompression &&
+		getHeader(data.Headers, "Accept-Encoding") == "" &&
+		getHeader(data.Headers, "Range") == "" &&
+		method != http.MethodHead {
+		data.Headers["Accept-Encoding"] = "gzip"
 	}
 
 	httpClient := http.Client{
 		Timeout: c.timeout,
 		Transport: &http.Transport{
-			TLSClientConfig: data.TLSConfig,
+			TLSClientConfig:    data.TLSConfig,
+			DisableCompression: disableTransportDecompression,
 		},
 		// Don't follow redirects by default:
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
@@ -178,9 +247,41 @@ func (c Client) makeRequest(
 	}
 
 	var resp *http.Response
+	attempt := 0
 	Retry(ctx, data.BaseRetryDelay, data.MaxRetryDelay, data.MaxRetries, func() bool {
+		attempt++
 		if bytesPayload != nil {
 			requestBody = bytes.NewReader(bytesPayload)
+		} else if reopenBody != nil && attempt > 1 {
+			requestBody, err = reopenBody()
+			if err != nil {
+				err = fmt.Errorf("error building multipart data: %v", err)
+				return false
+			}
+		}
+
+		if compressStream {
+			requestBody, err = newCompressingReader(data.CompressBody, requestBody)
+			if err != nil {
+				return false
+			}
+		}
+
+		var trailer http.Header
+		if data.ContentDigest != "" && bytesPayload == nil && requestBody != nil {
+			var digestHash hash.Hash
+			digestHash, err = newDigestHash(data.ContentDigest)
+			if err != nil {
+				return false
+			}
+
+			trailer = http.Header{"Content-Digest": nil}
+			requestBody = &digestingReader{
+				reader:    requestBody,
+				algorithm: data.ContentDigest,
+				hash:      digestHash,
+				trailer:   trailer,
+			}
 		}
 
 		var req *http.Request
@@ -188,6 +289,13 @@ func (c Client) makeRequest(
 		if err != nil {
 			return true
 		}
+		req.Trailer = trailer
+
+		// Streams are sent chunked unless their exact size is known, which is
+		// not the case after compressing them nor when sending trailers:
+		if contentLength >= 0 && !compressStream && trailer == nil {
+			req.ContentLength = contentLength
+		}
 
 		for k, value := range data.Headers {
 			switch v := value.(type) {
@@ -201,6 +309,12 @@ func (c Client) makeRequest(
 			}
 		}
 
+		// The transport only sends empty bodies with a `Content-Length: 0`
+		// if they are http.NoBody, otherwise they would be sent chunked:
+		if data.OnProgress != nil && req.Body != nil && req.Body != http.NoBody {
+			req.Body = newProgressReadCloser(req.Body, req.ContentLength, data.OnProgress)
+		}
+
 		resp, err = httpClient.Do(req)
 		return data.RetryRule(resp, err)
 	})
@@ -210,25 +324,170 @@ func (c Client) makeRequest(
 
 	isStatusSuccess := (resp.StatusCode >= 200 && resp.StatusCode < 300)
 
+	if data.OnProgress != nil {
+		resp.Body = newProgressReadCloser(resp.Body, resp.ContentLength, data.OnProgress)
+	}
+
+	var digests []expectedDigest
+	if data.VerifyResponseDigest {
+		digests, err = parseExpectedDigests(resp)
+		if err != nil {
+			_ = resp.Body.Close()
+			return Response{}, err
+		}
+	}
+
+	var contentEncoding string
+	var decompressors []Decompressor
+	if resp.Uncompressed {
+		// The transport already decompressed the body and removed the header,
+		// which it only does for gzip when it set the Accept-Encoding itself:
+		contentEncoding = "gzip"
+	} else if !data.DisableDecompression {
+		var ok bool
+		decompressors, ok = c.parseContentEncoding(resp.Header)
+		if ok {
+			contentEncoding = strings.Join(resp.Header.Values("Content-Encoding"), ", ")
+		}
+	}
+
+	limit := c.responseLimit(data)
+
 	var body []byte
 	bodyReader := io.ReadCloser(resp.Body)
 	if !data.Stream || !isStatusSuccess {
-		body, err = io.ReadAll(resp.Body)
+		body, err = readLimited(resp.Body, limit)
 		err = errors.Join(err, resp.Body.Close())
+		if err == nil {
+			// The digests are computed over the encoded content:
+			err = verifyDigests(digests, body)
+		}
+		if err == nil && len(decompressors) > 0 {
+			body, err = decompressBody(decompressors, body, limit)
+		} else if len(decompressors) > 0 {
+			// The body is returned still encoded, e.g. if it was truncated
+			// by the size limit, so we keep the headers describing it:
+			contentEncoding = ""
+		}
+		if errors.Is(err, ErrResponseTooLarge) {
+			err = fmt.Errorf("%s %s: %w", method, url, err)
+		}
 		bodyReader = io.NopCloser(bytes.NewReader(body))
+	} else {
+		if len(digests) > 0 {
+			bodyReader = newVerifyingReadCloser(bodyReader, digests)
+		}
+		if len(decompressors) > 0 {
+			bodyReader = newDecompressingReadCloser(decompressors, bodyReader)
+		}
+		if limit > 0 {
+			bodyReader = &limitedReadCloser{
+				ReadCloser: bodyReader,
+				limit:      limit,
+			}
+		}
 	}
 
-	if err == nil && !isStatusSuccess {
-		err = fmt.Errorf(
-			"%s %s: unexpected status code: %d, payload: %s",
-			method, url, resp.StatusCode, string(body),
-		)
+	if contentEncoding != "" {
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+	}
+
+	if !isStatusSuccess {
+		statusErr := newStatusError(method, url, resp.StatusCode, resp.Header.Get("Content-Type"), body)
+		if err != nil {
+			// Keep both errors so the caller can still check the status, e.g. when
+			// the body of the error response was larger than the size limit:
+			statusErr = fmt.Errorf("%w: %w", statusErr, err)
+		}
+		err = statusErr
 	}
 
 	return Response{
-		ReadCloser: bodyReader,
-		Body:       body,
-		Headers:    resp.Header,
-		StatusCode: resp.StatusCode,
+		ReadCloser:      bodyReader,
+		Body:            body,
+		Headers:         resp.Header,
+		StatusCode:      resp.StatusCode,
+		ContentEncoding: contentEncoding,
+		streamed:        data.Stream && isStatusSuccess,
 	}, err
 }
+
+// bufferBody replaces the body of the input RequestData by the exact payload
+// makeRequest would send, so middlewares can hash or sign it before the request
+// is sent. If the body implies a Content-Type, e.g. for bodies encoded by a codec,
+// the header is also set unless the caller already set it.
+//
+// If RequestData.CompressBody is set the payload is also compressed, and the
+// `Content-Encoding` header is set so makeRequest doesn't compress it again.
+//
+// It returns ok=false for streamed bodies, i.e. io.Reader, MultipartData
+// and MultipartForm, since these can't be read in advance.
+func bufferBody(data *RequestData) (payload []byte, ok bool, err error) {
+	if isStreamedBody(data.Body) {
+		return nil, false, nil
+	}
+
+	switch body := data.Body.(type) {
+	case nil:
+		return nil, true, nil
+	case []byte:
+		payload = body
+	case string:
+		payload = []byte(body)
+	default:
+		payload, err = marshalBody(data)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	payload, err = compressPayload(data, payload)
+	if err != nil {
+		return nil, false, err
+	}
+
+	data.Body = payload
+	return payload, true, nil
+}
+
+// marshalBody encodes the bodies that are neither streamed nor raw bytes,
+// i.e. form bodies and any other values, which are encoded using the request
+// codec, setting the Content-Type header unless the caller already set it.
+func marshalBody(data *RequestData) ([]byte, error) {
+	payload, isForm, err := encodeFormBody(data.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := formContentType
+	if !isForm {
+		codec := data.Codec
+		if codec == nil {
+			codec = JSONCodec{}
+		}
+
+		payload, err = codec.Marshal(data.Body)
+		if err != nil {
+			return nil, err
+		}
+		contentType = codec.ContentType()
+	}
+
+	if getHeader(data.Headers, "Content-Type") == "" {
+		data.Headers = copyHeaders(data.Headers)
+		data.Headers["Content-Type"] = contentType
+	}
+
+	return payload, nil
+}
+
+// isStreamedBody reports whether the body is sent as a stream,
+// i.e. if it can't be read in advance by the middlewares.
+func isStreamedBody(body any) bool {
+	switch body.(type) {
+	case io.Reader, map[string]io.Reader, MultipartForm:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package krest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrResponseTooLarge is returned when the response body is bigger than the
+// configured limit, see RequestData.MaxResponseBytes for details.
+var ErrResponseTooLarge = errors.New("response body too large")
+
+// maxErrorPayloadBytes caps the size of the response payloads
+// included in the error messages for non-2xx responses.
+const maxErrorPayloadBytes = 4096
+
+// SetMaxResponseBytes sets the default limit for the size of response bodies
+// for all requests made by this client, the RequestData.MaxResponseBytes
+// option takes precedence over it when set.
+func (c *Client) SetMaxResponseBytes(limit int64) {
+	c.maxResponseBytes = limit
+}
+
+func (c Client) responseLimit(data RequestData) int64 {
+	if data.MaxResponseBytes != 0 {
+		return data.MaxResponseBytes
+	}
+	return c.maxResponseBytes
+}
+
+// readLimited reads the whole input reader unless it is bigger than limit,
+// in which case the first `limit` bytes are returned with ErrResponseTooLarge.
+//
+// A limit <= 0 means no limit.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return body, err
+	}
+	if int64(len(body)) > limit {
+		return body[:limit], fmt.Errorf("%w: limit is %d bytes", ErrResponseTooLarge, limit)
+	}
+
+	return body, nil
+}
+
+// limitedReadCloser returns ErrResponseTooLarge instead of
+// the remaining data once more than `limit` bytes were read.
+type limitedReadCloser struct {
+	io.ReadCloser
+
+	limit int64
+	read  int64
+}
+
+// Read implements the io.Reader interface
+func (l *limitedReadCloser) Read(p []byte) (int, error) {
+	if l.read >= l.limit {
+		// Check if there is more data beyond the limit:
+		var b [1]byte
+		n, err := l.ReadCloser.Read(b[:])
+		if n > 0 {
+			return 0, fmt.Errorf("%w: limit is %d bytes", ErrResponseTooLarge, l.limit)
+		}
+		return 0, err
+	}
+
+	if remaining := l.limit - l.read; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.read += int64(n)
+	return n, err
+}
+
+// truncatePayload formats an error payload for
+// the error messages, capping its size.
+func truncatePayload(body []byte) string {
+	if len(body) <= maxErrorPayloadBytes {
+		return string(body)
+	}
+	return fmt.Sprintf("%s... (truncated from %d bytes)", body[:maxErrorPayloadBytes], len(body))
+}
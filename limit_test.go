@@ -0,0 +1,195 @@
+package krest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestMaxResponseBytes(t *testing.T) {
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		desc         string
+		body         string
+		status       int
+		stream       bool
+		requestLimit int64
+		clientLimit  int64
+		gzipResponse bool
+
+		expectedBody   string
+		expectTooLarge bool
+	}{
+		{
+			desc:         "should return the body if it is within the limit",
+			body:         "0123456789",
+			requestLimit: 10,
+			expectedBody: "0123456789",
+		},
+		{
+			desc:           "should truncate bodies above the limit",
+			body:           "0123456789",
+			requestLimit:   4,
+			expectedBody:   "0123",
+			expectTooLarge: true,
+		},
+		{
+			desc:           "should use the client default",
+			body:           "0123456789",
+			clientLimit:    4,
+			expectedBody:   "0123",
+			expectTooLarge: true,
+		},
+		{
+			desc:         "should let the request override the client default",
+			body:         "0123456789",
+			clientLimit:  4,
+			requestLimit: -1,
+			expectedBody: "0123456789",
+		},
+		{
+			desc:           "should limit error responses",
+			body:           "0123456789",
+			status:         http.StatusInternalServerError,
+			requestLimit:   4,
+			expectedBody:   "0123",
+			expectTooLarge: true,
+		},
+		{
+			desc:           "should limit stream responses",
+			body:           "0123456789",
+			stream:         true,
+			requestLimit:   4,
+			expectedBody:   "0123",
+			expectTooLarge: true,
+		},
+		{
+			desc:         "should not fail stream responses within the limit",
+			body:         "0123456789",
+			stream:       true,
+			requestLimit: 10,
+			expectedBody: "0123456789",
+		},
+		{
+			desc:           "should limit the size of decompressed bodies",
+			body:           strings.Repeat("0", 1000),
+			gzipResponse:   true,
+			requestLimit:   100,
+			expectedBody:   strings.Repeat("0", 100),
+			expectTooLarge: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body := []byte(test.body)
+				if test.gzipResponse {
+					var buf bytes.Buffer
+					gw := gzip.NewWriter(&buf)
+					_, _ = gw.Write(body)
+					_ = gw.Close()
+					body = buf.Bytes()
+					w.Header().Set("Content-Encoding", "gzip")
+				}
+				if test.status != 0 {
+					w.WriteHeader(test.status)
+				}
+				_, _ = w.Write(body)
+			}))
+			defer svr.Close()
+
+			client := New(time.Second)
+			client.SetMaxResponseBytes(test.clientLimit)
+
+			resp, err := client.Get(ctx, svr.URL, RequestData{
+				Headers: map[string]any{
+					"Accept-Encoding": "gzip",
+				},
+				Stream:           test.stream,
+				MaxResponseBytes: test.requestLimit,
+			})
+
+			body := resp.Body
+			if test.stream && err == nil {
+				body, err = io.ReadAll(resp)
+				_ = resp.Close()
+			}
+
+			tt.AssertEqual(t, errors.Is(err, ErrResponseTooLarge), test.expectTooLarge)
+			if test.expectTooLarge {
+				tt.AssertErrContains(t, err, "too large")
+			}
+			if !test.expectTooLarge && test.status == 0 {
+				tt.AssertNoErr(t, err)
+			}
+			tt.AssertEqual(t, string(body), test.expectedBody)
+		})
+	}
+
+	t.Run("should keep the encoding headers if the encoded body is truncated", func(t *testing.T) {
+		var compressed bytes.Buffer
+		gw := gzip.NewWriter(&compressed)
+		for i := 0; i < 1000; i++ {
+			_, _ = fmt.Fprintf(gw, "%d,", i*i)
+		}
+		_ = gw.Close()
+
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(compressed.Bytes())
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		resp, err := client.Get(ctx, svr.URL, RequestData{
+			Headers: map[string]any{
+				"Accept-Encoding": "gzip",
+			},
+			MaxResponseBytes: 100,
+		})
+		tt.AssertEqual(t, errors.Is(err, ErrResponseTooLarge), true)
+		tt.AssertEqual(t, resp.Body, compressed.Bytes()[:100])
+		tt.AssertEqual(t, resp.ContentEncoding, "")
+		tt.AssertEqual(t, resp.Headers.Get("Content-Encoding"), "gzip")
+	})
+
+	t.Run("should return the status error with the size limit error", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = io.WriteString(w, "0123456789")
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		_, err := client.Get(ctx, svr.URL, RequestData{
+			MaxResponseBytes: 4,
+		})
+		tt.AssertEqual(t, errors.Is(err, ErrResponseTooLarge), true)
+		tt.AssertErrContains(t, err, "unexpected status code: 503", "payload: 0123")
+	})
+
+	t.Run("should cap the payload included in error messages", func(t *testing.T) {
+		payload := strings.Repeat("x", maxErrorPayloadBytes+100)
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, payload)
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		resp, err := client.Get(ctx, svr.URL, RequestData{})
+		tt.AssertErrContains(t, err, "400", "truncated from 4196 bytes")
+		tt.AssertEqual(t, strings.Contains(err.Error(), payload), false)
+		tt.AssertEqual(t, string(resp.Body), payload)
+	})
+}
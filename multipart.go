@@ -6,13 +6,58 @@ import (
 	"io"
 	"mime/multipart"
 	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 )
 
 // MultipartData is a helper type for storing the
 // multipart data payload in a practical structure.
+//
+// The parts are sent sorted by their field names, if
+// you need a specific order use krest.MultipartForm instead.
 type MultipartData = map[string]io.Reader
 
+// MultipartForm is a multipart data payload whose parts are sent in the
+// same order they appear on the slice, it also allows repeated field names:
+//
+//	Body: krest.MultipartForm{
+//		{Name: "files[]", Filename: "a.png", ContentType: "image/png", Reader: fileA},
+//		{Name: "files[]", Filename: "b.png", ContentType: "image/png", Reader: fileB},
+//	},
+type MultipartForm []MultipartPart
+
+// MultipartPart describes a single part of a krest.MultipartForm
+type MultipartPart struct {
+	// Name is the name of the form field
+	Name string
+
+	// Filename is sent on the `Content-Disposition` header if set, in
+	// which case the ContentType defaults to "application/octet-stream"
+	Filename string
+
+	// ContentType is sent on the `Content-Type` header of the part if set
+	ContentType string
+
+	// Header contains any other MIME headers of the part, the ones set by
+	// the fields above take precedence over it, except for the
+	// `Content-Disposition` which is only generated if missing.
+	Header textproto.MIMEHeader
+
+	// Reader is the content of the part, it also accepts the values
+	// returned by krest.MultipartFile() and krest.MultipartItem()
+	Reader io.Reader
+
+	// Size is the number of bytes that will be read from the Reader, if 0 it is
+	// detected from the Reader when possible. If the sizes of all the parts are
+	// known the `Content-Length` of the request is set, otherwise it is chunked.
+	//
+	// Only the first Size bytes of the Reader are sent, and the request fails
+	// if the Reader ends before that.
+	Size int64
+}
+
 type multipartFile struct {
 	io.Reader
 	name string
@@ -40,23 +85,181 @@ func MultipartItem(data io.Reader, contentType string) io.Reader {
 	}
 }
 
+// multipartSource is a part content that can be opened once per
+// attempt, which allows multipart requests to be retried.
+type multipartSource struct {
+	name string
+	open func() (io.Reader, error)
+
+	// size is nil if the size of the source is unknown
+	size func() (int64, error)
+}
+
+// Read implements the io.Reader interface, the source is never
+// read directly, instead krest opens a new reader for each attempt.
+func (s multipartSource) Read([]byte) (int, error) {
+	return 0, fmt.Errorf("krest: multipart sources can only be sent as part of a multipart body")
+}
+
+// MultipartFilePath is a helper for sending the file at the input path as
+// a part of the multipart data payload, the file is opened again on each
+// retry and its base name is used as the filename of the part.
+func MultipartFilePath(path string) io.Reader {
+	return multipartSource{
+		name: filepath.Base(path),
+		open: func() (io.Reader, error) {
+			return os.Open(path)
+		},
+		size: func() (int64, error) {
+			info, err := os.Stat(path)
+			if err != nil {
+				return 0, err
+			}
+			return info.Size(), nil
+		},
+	}
+}
+
+// MultipartReaderAt is a helper for sending the first `size` bytes of an
+// io.ReaderAt as a part of the multipart data payload, allowing it to be
+// read again from the start on each retry.
+func MultipartReaderAt(data io.ReaderAt, size int64) io.Reader {
+	return multipartSource{
+		open: func() (io.Reader, error) {
+			return io.NewSectionReader(data, 0, size), nil
+		},
+		size: func() (int64, error) {
+			return size, nil
+		},
+	}
+}
+
+// MultipartOpener is a helper for sending the content returned by the `open`
+// function as a part of the multipart data payload, the function is called
+// once for each retry and the returned reader is closed if it is an io.Closer.
+func MultipartOpener(open func() (io.Reader, error)) io.Reader {
+	return multipartSource{
+		open: open,
+	}
+}
+
+// isReplayableForm reports whether all the parts of the form
+// can be reopened, which is necessary for retrying a request.
+func isReplayableForm(form MultipartForm) bool {
+	for _, part := range form {
+		if _, ok := normalizePart(part).Reader.(multipartSource); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// multipartContentLength computes the exact size of the encoded form, or
+// returns ok=false if the size of any of the parts is unknown.
+func multipartContentLength(form MultipartForm, boundary string) (_ int64, ok bool) {
+	var counter byteCounter
+	w := multipart.NewWriter(&counter)
+	err := w.SetBoundary(boundary)
+	if err != nil {
+		return 0, false
+	}
+
+	var total int64
+	for _, part := range form {
+		part = normalizePart(part)
+		size, ok := partSize(part)
+		if !ok {
+			return 0, false
+		}
+		total += size
+
+		// The headers and boundaries don't depend on the content of the parts:
+		_, err := w.CreatePart(partHeader(part))
+		if err != nil {
+			return 0, false
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		return 0, false
+	}
+
+	return total + counter.n, true
+}
+
+func partSize(part MultipartPart) (_ int64, ok bool) {
+	if part.Size > 0 {
+		return part.Size, true
+	}
+
+	switch reader := part.Reader.(type) {
+	case *bytes.Reader:
+		return int64(reader.Len()), true
+	case *strings.Reader:
+		return int64(reader.Len()), true
+	case *os.File:
+		info, err := reader.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+		offset, err := reader.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		return info.Size() - offset, true
+	case multipartSource:
+		if reader.size == nil {
+			return 0, false
+		}
+		size, err := reader.size()
+		return size, err == nil
+	}
+
+	return 0, false
+}
+
+// byteCounter is an io.Writer that only counts the bytes written to it
+type byteCounter struct {
+	n int64
+}
+
+// Write implements the io.Writer interface
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
 type multipartStream struct {
 	formClosed      bool
 	multipartWriter *multipart.Writer
-	parts           []formPart
+	parts           []MultipartPart
 
 	currentPartWriter io.Writer
 	currentPartReader io.Reader
+	currentPartCloser io.Closer
 
 	buf *bytes.Buffer
 }
 
-type formPart struct {
-	reader    io.Reader
-	fieldname string
+// multipartFormFromMap converts the input map to a
+// krest.MultipartForm sorting the parts by their field names.
+func multipartFormFromMap(data MultipartData) MultipartForm {
+	form := make(MultipartForm, 0, len(data))
+	for name, reader := range data {
+		form = append(form, MultipartPart{
+			Name:   name,
+			Reader: reader,
+		})
+	}
+
+	sort.Slice(form, func(i, j int) bool {
+		return form[i].Name < form[j].Name
+	})
+	return form
 }
 
-func newMultipartStream(data MultipartData) (_ *multipartStream, contentType string, err error) {
+func newMultipartStream(form MultipartForm) (_ *multipartStream, contentType string, err error) {
 	var buffer bytes.Buffer
 	multipartWriter := multipart.NewWriter(&buffer)
 
@@ -67,12 +270,7 @@ func newMultipartStream(data MultipartData) (_ *multipartStream, contentType str
 		multipartWriter: multipartWriter,
 	}
 
-	for key, reader := range data {
-		stream.parts = append(stream.parts, formPart{
-			reader:    reader,
-			fieldname: key,
-		})
-	}
+	stream.parts = append(stream.parts, form...)
 
 	return &stream, multipartWriter.FormDataContentType(), nil
 }
@@ -120,7 +318,9 @@ func (m *multipartStream) loadFormBuffer(buf *bytes.Buffer, numBytes int64) (err
 		// If this part is finished:
 		m.currentPartReader = nil
 		m.currentPartWriter = nil
+		return m.closeCurrentPart()
 	} else if err != nil {
+		_ = m.closeCurrentPart()
 		return err
 	}
 
@@ -128,30 +328,129 @@ func (m *multipartStream) loadFormBuffer(buf *bytes.Buffer, numBytes int64) (err
 }
 
 func (m *multipartStream) loadNextPart() (io.Reader, io.Writer, error) {
-	p := m.parts[0]
+	p := normalizePart(m.parts[0])
 	m.parts = m.parts[1:]
-	writer, err := createFormPart(m.multipartWriter, p.reader, p.fieldname)
-	return p.reader, writer, err
-}
 
-func createFormPart(w *multipart.Writer, reader io.Reader, fieldname string) (io.Writer, error) {
-	switch reader := reader.(type) {
-	case multipartFile:
-		return w.CreateFormFile(fieldname, reader.name)
-	case multipartItem:
-		header := textproto.MIMEHeader{
-			"Content-Disposition": []string{fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(fieldname))},
+	reader := p.Reader
+	if source, ok := reader.(multipartSource); ok {
+		var err error
+		reader, err = source.open()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error opening multipart field '%s': %w", p.Name, err)
 		}
-		if reader.contentType != "" {
-			header.Set("Content-Type", reader.contentType)
+		if closer, ok := reader.(io.Closer); ok {
+			m.currentPartCloser = closer
 		}
-		return w.CreatePart(header)
-	default:
-		header := textproto.MIMEHeader{
-			"Content-Disposition": []string{fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(fieldname))},
+	}
+
+	// The size of the part is enforced since it might
+	// have been used for computing the Content-Length:
+	if size, ok := partSize(p); ok {
+		reader = &sizedReader{
+			reader: io.LimitReader(reader, size),
+			name:   p.Name,
+			size:   size,
 		}
-		return w.CreatePart(header)
 	}
+
+	writer, err := createFormPart(m.multipartWriter, p)
+	if err != nil {
+		_ = m.closeCurrentPart()
+	}
+	return reader, writer, err
+}
+
+// sizedReader returns an error if the reader
+// ends before the expected size is reached.
+type sizedReader struct {
+	reader io.Reader
+	name   string
+	size   int64
+	read   int64
+}
+
+// Read implements the io.Reader interface
+func (s *sizedReader) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	s.read += int64(n)
+	if err == io.EOF && s.read < s.size {
+		return n, fmt.Errorf(
+			"multipart field '%s' ended after %d bytes but its size is %d bytes",
+			s.name, s.read, s.size,
+		)
+	}
+	return n, err
+}
+
+func (m *multipartStream) closeCurrentPart() error {
+	if m.currentPartCloser == nil {
+		return nil
+	}
+	err := m.currentPartCloser.Close()
+	m.currentPartCloser = nil
+	return err
+}
+
+// Close implements the io.Closer interface, it closes the reader of
+// the current part if it was opened by the multipartStream itself.
+func (m *multipartStream) Close() error {
+	return m.closeCurrentPart()
+}
+
+// normalizePart moves the attributes of the readers created by
+// krest.MultipartFile(), krest.MultipartItem() and krest.MultipartFilePath()
+// to the part itself, unwrapping them in case they are nested.
+func normalizePart(part MultipartPart) MultipartPart {
+	for {
+		switch reader := part.Reader.(type) {
+		case multipartFile:
+			if part.Filename == "" {
+				part.Filename = reader.name
+			}
+			part.Reader = reader.Reader
+		case multipartItem:
+			if part.ContentType == "" {
+				part.ContentType = reader.contentType
+			}
+			part.Reader = reader.Reader
+		case multipartSource:
+			if part.Filename == "" {
+				part.Filename = reader.name
+			}
+			return part
+		default:
+			return part
+		}
+	}
+}
+
+func createFormPart(w *multipart.Writer, part MultipartPart) (io.Writer, error) {
+	return w.CreatePart(partHeader(part))
+}
+
+func partHeader(part MultipartPart) textproto.MIMEHeader {
+	header := textproto.MIMEHeader{}
+	for key, values := range part.Header {
+		header[textproto.CanonicalMIMEHeaderKey(key)] = values
+	}
+
+	if header.Get("Content-Disposition") == "" {
+		disposition := fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(part.Name))
+		if part.Filename != "" {
+			disposition += fmt.Sprintf(`; filename="%s"`, escapeQuotes(part.Filename))
+		}
+		header.Set("Content-Disposition", disposition)
+	}
+
+	contentType := part.ContentType
+	if contentType == "" && part.Filename != "" && header.Get("Content-Type") == "" {
+		contentType = "application/octet-stream"
+	}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	return header
 }
 
 var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
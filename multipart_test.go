@@ -1,6 +1,7 @@
 package krest
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"mime"
@@ -8,6 +9,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/textproto"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -132,10 +135,10 @@ func TestMultipartRequests(t *testing.T) {
 
 func TestMultipartStream(t *testing.T) {
 	t.Run("should stream normal readers correctly", func(t *testing.T) {
-		stream, contentType, err := newMultipartStream(map[string]io.Reader{
+		stream, contentType, err := newMultipartStream(multipartFormFromMap(map[string]io.Reader{
 			"item1": strings.NewReader(`{"fake":"json"}`),
 			"item2": strings.NewReader(`================ other payload ==================`),
-		})
+		}))
 		tt.AssertEqual(t, nil, err)
 
 		boundary := stream.multipartWriter.Boundary()
@@ -162,10 +165,10 @@ func TestMultipartStream(t *testing.T) {
 	})
 
 	t.Run("should stream items with Content-Type correctly", func(t *testing.T) {
-		stream, contentType, err := newMultipartStream(map[string]io.Reader{
+		stream, contentType, err := newMultipartStream(multipartFormFromMap(map[string]io.Reader{
 			"item1": MultipartItem(strings.NewReader(`{"fake":"json"}`), "application/json"),
 			"item2": strings.NewReader(`================ other payload ==================`),
-		})
+		}))
 		tt.AssertEqual(t, nil, err)
 
 		boundary := stream.multipartWriter.Boundary()
@@ -193,10 +196,10 @@ func TestMultipartStream(t *testing.T) {
 	})
 
 	t.Run("should stream files correctly", func(t *testing.T) {
-		stream, contentType, err := newMultipartStream(map[string]io.Reader{
+		stream, contentType, err := newMultipartStream(multipartFormFromMap(map[string]io.Reader{
 			"item1": strings.NewReader(`{"fake":"json"}`),
 			"item2": MultipartFile(strings.NewReader(`================ other payload ==================`), "fake-filename"),
-		})
+		}))
 		tt.AssertEqual(t, nil, err)
 
 		boundary := stream.multipartWriter.Boundary()
@@ -224,3 +227,391 @@ func TestMultipartStream(t *testing.T) {
 		tt.AssertEqual(t, 1, strings.Count(payload, `Content-Type: application/octet-stream`))
 	})
 }
+
+func TestMultipartOrder(t *testing.T) {
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		desc string
+		body interface{}
+
+		expectedOrder []string
+	}{
+		{
+			desc: "should send MultipartForm parts in order",
+			body: MultipartForm{
+				{Name: "metadata", Reader: MultipartItem(strings.NewReader(`{}`), "application/json")},
+				{Name: "file", Reader: MultipartFile(strings.NewReader("fakeBlob"), "fakeFilename")},
+				{Name: "checksum", Reader: strings.NewReader("fakeChecksum")},
+			},
+			expectedOrder: []string{"metadata", "file", "checksum"},
+		},
+		{
+			desc: "should send MultipartData parts sorted by name",
+			body: MultipartData{
+				"c": strings.NewReader("fakeC"),
+				"a": strings.NewReader("fakeA"),
+				"d": strings.NewReader("fakeD"),
+				"b": strings.NewReader("fakeB"),
+			},
+			expectedOrder: []string{"a", "b", "c", "d"},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var order []string
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mr, err := r.MultipartReader()
+				tt.AssertNoErr(t, err)
+
+				for {
+					p, err := mr.NextPart()
+					if err == io.EOF {
+						return
+					}
+					tt.AssertNoErr(t, err)
+					order = append(order, p.FormName())
+				}
+			}))
+			defer svr.Close()
+
+			client := New(time.Second)
+			_, err := client.Post(ctx, svr.URL, RequestData{
+				Body: test.body,
+			})
+			tt.AssertNoErr(t, err)
+			tt.AssertEqual(t, order, test.expectedOrder)
+		})
+	}
+}
+
+func TestMultipartPartHeaders(t *testing.T) {
+	ctx := context.Background()
+
+	type part struct {
+		name        string
+		filename    string
+		contentType string
+		custom      string
+		content     string
+	}
+
+	for _, test := range []struct {
+		desc string
+		form MultipartForm
+
+		expectedParts []part
+	}{
+		{
+			desc: "should allow repeated field names",
+			form: MultipartForm{
+				{Name: "files[]", Filename: "a.png", ContentType: "image/png", Reader: strings.NewReader("fakeA")},
+				{Name: "files[]", Filename: "b.txt", Reader: strings.NewReader("fakeB")},
+			},
+			expectedParts: []part{
+				{name: "files[]", filename: "a.png", contentType: "image/png", content: "fakeA"},
+				{name: "files[]", filename: "b.txt", contentType: "application/octet-stream", content: "fakeB"},
+			},
+		},
+		{
+			desc: "should send custom headers",
+			form: MultipartForm{
+				{
+					Name:        "metadata",
+					ContentType: "application/json",
+					Header: textproto.MIMEHeader{
+						"x-custom-header": []string{"fakeValue"},
+						"Content-Type":    []string{"text/plain"},
+					},
+					Reader: strings.NewReader(`{}`),
+				},
+			},
+			expectedParts: []part{
+				{name: "metadata", contentType: "application/json", custom: "fakeValue", content: `{}`},
+			},
+		},
+		{
+			desc: "should combine the part fields with MultipartFile and MultipartItem",
+			form: MultipartForm{
+				{Name: "file", ContentType: "text/csv", Reader: MultipartFile(strings.NewReader("fakeCSV"), "data.csv")},
+				{Name: "item", Filename: "item.json", Reader: MultipartItem(strings.NewReader(`{}`), "application/json")},
+			},
+			expectedParts: []part{
+				{name: "file", filename: "data.csv", contentType: "text/csv", content: "fakeCSV"},
+				{name: "item", filename: "item.json", contentType: "application/json", content: `{}`},
+			},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var parts []part
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mr, err := r.MultipartReader()
+				tt.AssertNoErr(t, err)
+
+				for {
+					p, err := mr.NextPart()
+					if err == io.EOF {
+						return
+					}
+					tt.AssertNoErr(t, err)
+
+					content, err := io.ReadAll(p)
+					tt.AssertNoErr(t, err)
+					parts = append(parts, part{
+						name:        p.FormName(),
+						filename:    p.FileName(),
+						contentType: p.Header.Get("Content-Type"),
+						custom:      p.Header.Get("X-Custom-Header"),
+						content:     string(content),
+					})
+				}
+			}))
+			defer svr.Close()
+
+			client := New(time.Second)
+			_, err := client.Post(ctx, svr.URL, RequestData{
+				Body: test.form,
+			})
+			tt.AssertNoErr(t, err)
+			tt.AssertEqual(t, parts, test.expectedParts)
+		})
+	}
+}
+
+func TestRetryableMultipart(t *testing.T) {
+	ctx := context.Background()
+
+	randMillis = func() time.Duration {
+		return 0
+	}
+	defer func() {
+		randMillis = DefaultRandMillis
+	}()
+
+	path := filepath.Join(t.TempDir(), "report.csv")
+	err := os.WriteFile(path, []byte("fakeCSV"), 0o600)
+	tt.AssertNoErr(t, err)
+
+	var opened int
+	form := MultipartForm{
+		{Name: "file", Reader: MultipartFilePath(path)},
+		{Name: "blob", Reader: MultipartItem(MultipartReaderAt(strings.NewReader("fakeBlobAndMore"), 8), "application/octet-stream")},
+		{Name: "generated", Reader: MultipartOpener(func() (io.Reader, error) {
+			opened++
+			return strings.NewReader("fakeGenerated"), nil
+		})},
+	}
+
+	type part struct {
+		name     string
+		filename string
+		content  string
+	}
+
+	var attempts [][]part
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		tt.AssertNoErr(t, err)
+
+		var parts []part
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			tt.AssertNoErr(t, err)
+
+			content, err := io.ReadAll(p)
+			tt.AssertNoErr(t, err)
+			parts = append(parts, part{
+				name:     p.FormName(),
+				filename: p.FileName(),
+				content:  string(content),
+			})
+		}
+		attempts = append(attempts, parts)
+
+		if len(attempts) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer svr.Close()
+
+	client := New(time.Second)
+	_, err = client.Post(ctx, svr.URL, RequestData{
+		Body:           form,
+		MaxRetries:     3,
+		BaseRetryDelay: time.Millisecond,
+	})
+	tt.AssertNoErr(t, err)
+
+	expectedParts := []part{
+		{name: "file", filename: "report.csv", content: "fakeCSV"},
+		{name: "blob", content: "fakeBlob"},
+		{name: "generated", content: "fakeGenerated"},
+	}
+	tt.AssertEqual(t, attempts, [][]part{expectedParts, expectedParts, expectedParts})
+	tt.AssertEqual(t, opened, 3)
+
+	t.Run("should reject retries for parts that can't be reopened", func(t *testing.T) {
+		_, err := client.Post(ctx, svr.URL, RequestData{
+			Body: MultipartData{
+				"file": MultipartFilePath(path),
+				"blob": strings.NewReader("fakeBlob"),
+			},
+			MaxRetries: 3,
+		})
+		tt.AssertErrContains(t, err, "can't retry")
+	})
+
+	t.Run("should report errors opening the parts", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.ReadAll(r.Body)
+		}))
+		defer svr.Close()
+
+		_, err := client.Post(ctx, svr.URL, RequestData{
+			Body: MultipartData{
+				"file": MultipartFilePath(filepath.Join(t.TempDir(), "missing.csv")),
+			},
+		})
+		tt.AssertErrContains(t, err, "error opening multipart field 'file'")
+	})
+}
+
+func TestMultipartContentLength(t *testing.T) {
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "report.csv")
+	err := os.WriteFile(path, []byte("fakeCSV"), 0o600)
+	tt.AssertNoErr(t, err)
+
+	openFile := func(t *testing.T) *os.File {
+		f, err := os.Open(path)
+		tt.AssertNoErr(t, err)
+		t.Cleanup(func() { _ = f.Close() })
+		return f
+	}
+
+	for _, test := range []struct {
+		desc string
+		body func(t *testing.T) interface{}
+
+		expectChunked bool
+	}{
+		{
+			desc: "should compute the length of in-memory readers",
+			body: func(t *testing.T) interface{} {
+				return MultipartData{
+					"bytes":  bytes.NewReader([]byte("fakeBytes")),
+					"string": MultipartItem(strings.NewReader(`{}`), "application/json"),
+				}
+			},
+		},
+		{
+			desc: "should compute the length of files and sources",
+			body: func(t *testing.T) interface{} {
+				return MultipartForm{
+					{Name: "file", Reader: MultipartFile(openFile(t), "report.csv")},
+					{Name: "path", Reader: MultipartFilePath(path)},
+					{Name: "readerAt", Reader: MultipartReaderAt(strings.NewReader("fakeBlobAndMore"), 8)},
+					{
+						Name:   "custom",
+						Header: textproto.MIMEHeader{"X-Custom-Header": []string{"fakeValue"}},
+						Reader: strings.NewReader("fakeCustom"),
+					},
+				}
+			},
+		},
+		{
+			desc: "should use the explicit size of the parts",
+			body: func(t *testing.T) interface{} {
+				return MultipartForm{
+					{Name: "generated", Size: 13, Reader: MultipartOpener(func() (io.Reader, error) {
+						return io.MultiReader(strings.NewReader("fakeGenerated")), nil
+					})},
+				}
+			},
+		},
+		{
+			desc: "should send the body chunked if any size is unknown",
+			body: func(t *testing.T) interface{} {
+				return MultipartData{
+					"known":   strings.NewReader("fakeKnown"),
+					"unknown": io.MultiReader(strings.NewReader("fakeUnknown")),
+				}
+			},
+			expectChunked: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var contentLength int64
+			var transferEncoding []string
+			var body []byte
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentLength = r.ContentLength
+				transferEncoding = r.TransferEncoding
+				body, _ = io.ReadAll(r.Body)
+			}))
+			defer svr.Close()
+
+			client := New(time.Second)
+			_, err := client.Post(ctx, svr.URL, RequestData{
+				Body: test.body(t),
+			})
+			tt.AssertNoErr(t, err)
+
+			if test.expectChunked {
+				tt.AssertEqual(t, contentLength, int64(-1))
+				tt.AssertEqual(t, transferEncoding, []string{"chunked"})
+				return
+			}
+			tt.AssertEqual(t, contentLength, int64(len(body)))
+			tt.AssertEqual(t, len(transferEncoding), 0)
+		})
+	}
+
+	t.Run("should only send Size bytes of parts with larger readers", func(t *testing.T) {
+		var contentLength int64
+		var content string
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentLength = r.ContentLength
+			mr, err := r.MultipartReader()
+			tt.AssertNoErr(t, err)
+
+			p, err := mr.NextPart()
+			tt.AssertNoErr(t, err)
+			data, err := io.ReadAll(p)
+			tt.AssertNoErr(t, err)
+			content = string(data)
+
+			_, err = mr.NextPart()
+			tt.AssertEqual(t, err, io.EOF)
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		_, err := client.Post(ctx, svr.URL, RequestData{
+			Body: MultipartForm{
+				{Name: "blob", Size: 4, Reader: io.MultiReader(strings.NewReader("fakeBlob"))},
+			},
+		})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, content, "fake")
+		tt.AssertNotEqual(t, contentLength, int64(-1))
+	})
+
+	t.Run("should fail if a part is smaller than its Size", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.ReadAll(r.Body)
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		_, err := client.Post(ctx, svr.URL, RequestData{
+			Body: MultipartForm{
+				{Name: "blob", Size: 100, Reader: io.MultiReader(strings.NewReader("fakeBlob"))},
+			},
+		})
+		tt.AssertErrContains(t, err, "multipart field 'blob' ended after 8 bytes but its size is 100 bytes")
+	})
+}
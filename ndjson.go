@@ -0,0 +1,171 @@
+package krest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// maxNDJSONLineBytes is the maximum size of a single
+// record accepted by the NDJSON iterator.
+const maxNDJSONLineBytes = 16 * 1024 * 1024
+
+// NDJSONIterator decodes a newline-delimited JSON response one record
+// at a time, see krest.NDJSON() for details.
+type NDJSONIterator[T any] struct {
+	ctx     context.Context
+	body    *streamBody
+	scanner *bufio.Scanner
+
+	line  int
+	value T
+	err   error
+}
+
+// NDJSON returns an iterator that decodes each line of the response body
+// (NDJSON or JSON Lines) into a value of type T, reading a single record
+// at a time so the memory usage doesn't depend on the size of the body:
+//
+//	records := krest.NDJSON[Record](ctx, resp)
+//	defer records.Close()
+//	for records.Next() {
+//		record := records.Value()
+//		// ...
+//	}
+//	if err := records.Err(); err != nil {
+//		// ...
+//	}
+//
+// Empty lines are skipped, and the body is closed when the iteration ends,
+// when the context is canceled or when Close() is called, so it is safe to
+// stop iterating early as long as Close() is deferred.
+//
+// It should be used along with the Stream option,
+// otherwise the whole body is loaded into memory first.
+func NDJSON[T any](ctx context.Context, resp Response) *NDJSONIterator[T] {
+	body := newStreamBody(ctx, resp.ReadCloser)
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, maxNDJSONLineBytes)
+
+	return &NDJSONIterator[T]{
+		ctx:     ctx,
+		body:    body,
+		scanner: scanner,
+	}
+}
+
+// Next decodes the next record, returning false when there are no more
+// records or if an error occurred, in which case it is returned by Err().
+func (it *NDJSONIterator[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	for {
+		if err := it.ctx.Err(); err != nil {
+			it.fail(err)
+			return false
+		}
+
+		if !it.scanner.Scan() {
+			err := it.scanner.Err()
+			if it.ctx.Err() != nil {
+				err = it.ctx.Err()
+			} else if errors.Is(err, bufio.ErrTooLong) {
+				err = fmt.Errorf("NDJSON line %d: %w", it.line+1, err)
+			} else if err != nil {
+				err = fmt.Errorf("error reading NDJSON stream: %w", err)
+			} else {
+				err = io.EOF
+			}
+			it.fail(err)
+			return false
+		}
+		it.line++
+
+		line := it.scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var value T
+		err := json.Unmarshal(line, &value)
+		if err != nil {
+			it.fail(fmt.Errorf("error decoding NDJSON line %d: %w", it.line, err))
+			return false
+		}
+
+		it.value = value
+		return true
+	}
+}
+
+// Value returns the record decoded by the last call to Next()
+func (it *NDJSONIterator[T]) Value() T {
+	return it.value
+}
+
+// Line returns the line number of the last record read, starting from 1
+func (it *NDJSONIterator[T]) Line() int {
+	return it.line
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *NDJSONIterator[T]) Err() error {
+	if it.err == io.EOF {
+		return nil
+	}
+	return it.err
+}
+
+// Close closes the response body, it is safe to call it more than once
+func (it *NDJSONIterator[T]) Close() error {
+	return it.body.Close()
+}
+
+func (it *NDJSONIterator[T]) fail(err error) {
+	it.err = err
+	_ = it.Close()
+}
+
+// streamBody wraps a streamed response body so it is closed when the
+// context is canceled, which is the only way of interrupting a blocked read.
+type streamBody struct {
+	io.ReadCloser
+
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newStreamBody(ctx context.Context, body io.ReadCloser) *streamBody {
+	s := &streamBody{
+		ReadCloser: body,
+		done:       make(chan struct{}),
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = s.Close()
+		case <-s.done:
+		}
+	}()
+
+	return s
+}
+
+// Close implements the io.Closer interface, it is safe to call it more than once
+func (s *streamBody) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.closeErr = s.ReadCloser.Close()
+	})
+	return s.closeErr
+}
@@ -0,0 +1,131 @@
+package krest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+type fakeReadCloser struct {
+	io.Reader
+	closed bool
+}
+
+func (f *fakeReadCloser) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestNDJSON(t *testing.T) {
+	ctx := context.Background()
+
+	type record struct {
+		ID int `json:"id"`
+	}
+
+	t.Run("should decode one record per line", func(t *testing.T) {
+		for _, test := range []struct {
+			desc string
+			body string
+
+			expectedRecords    []record
+			expectErrToContain []string
+		}{
+			{
+				desc:            "newline terminated records",
+				body:            "{\"id\":1}\n{\"id\":2}\n",
+				expectedRecords: []record{{ID: 1}, {ID: 2}},
+			},
+			{
+				desc:            "CRLF, empty lines and no final newline",
+				body:            "{\"id\":1}\r\n\r\n  \n{\"id\":2}",
+				expectedRecords: []record{{ID: 1}, {ID: 2}},
+			},
+			{
+				desc:               "invalid records",
+				body:               "{\"id\":1}\n\n{\"id\":\"invalid\"}\n{\"id\":3}\n",
+				expectedRecords:    []record{{ID: 1}},
+				expectErrToContain: []string{"line 3"},
+			},
+		} {
+			t.Run(test.desc, func(t *testing.T) {
+				body := &fakeReadCloser{Reader: strings.NewReader(test.body)}
+
+				records := NDJSON[record](ctx, Response{ReadCloser: body})
+				defer records.Close()
+
+				var got []record
+				for records.Next() {
+					got = append(got, records.Value())
+				}
+
+				if test.expectErrToContain != nil {
+					tt.AssertErrContains(t, records.Err(), test.expectErrToContain...)
+				} else {
+					tt.AssertNoErr(t, records.Err())
+				}
+				tt.AssertEqual(t, got, test.expectedRecords)
+				tt.AssertEqual(t, body.closed, true)
+			})
+		}
+	})
+
+	t.Run("should close the body on early exit", func(t *testing.T) {
+		body := &fakeReadCloser{Reader: strings.NewReader("{\"id\":1}\n{\"id\":2}\n")}
+
+		func() {
+			records := NDJSON[record](ctx, Response{ReadCloser: body})
+			defer records.Close()
+
+			records.Next()
+		}()
+
+		tt.AssertEqual(t, body.closed, true)
+	})
+
+	t.Run("should stream records from the server", func(t *testing.T) {
+		unblock := make(chan struct{})
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			_, _ = fmt.Fprint(w, "{\"id\":1}\n")
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-unblock:
+			case <-r.Context().Done():
+			}
+		}))
+		defer svr.Close()
+		defer close(unblock)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		client := New(0)
+		resp, err := client.Get(ctx, svr.URL, RequestData{
+			Stream: true,
+		})
+		tt.AssertNoErr(t, err)
+
+		records := NDJSON[record](ctx, resp)
+		defer records.Close()
+
+		tt.AssertEqual(t, records.Next(), true)
+		tt.AssertEqual(t, records.Value(), record{ID: 1})
+
+		// The next call blocks until the context is canceled:
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+		tt.AssertEqual(t, records.Next(), false)
+		tt.AssertErrContains(t, records.Err(), "context canceled")
+	})
+}
@@ -0,0 +1,276 @@
+package krest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The grant types supported by the OAuth2 middleware
+const (
+	OAuth2ClientCredentials = "client_credentials"
+	OAuth2RefreshToken      = "refresh_token"
+	OAuth2JWTBearer         = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+// OAuth2Config describes the configurations of the OAuth2 middleware
+type OAuth2Config struct {
+	// The URL of the token endpoint of the authorization server
+	TokenURL string
+
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	// GrantType defaults to `OAuth2ClientCredentials` if unset
+	GrantType string
+
+	// RefreshToken is required for the `OAuth2RefreshToken` grant type,
+	// if the authorization server rotates the refresh token the new one
+	// will be used on the next refresh.
+	RefreshToken string
+
+	// Assertion is required for the `OAuth2JWTBearer` grant type and
+	// should return a new signed JWT each time it is called.
+	Assertion func(ctx context.Context) (string, error)
+
+	// Any extra parameters to send to the token endpoint, e.g. `audience`
+	ExtraParams url.Values
+
+	// By default the client credentials are sent using HTTP Basic auth,
+	// set this option to send them on the request body instead.
+	AuthInBody bool
+
+	// ExpiryDelta is how long before the `expires_in` deadline
+	// the token is considered expired, if unset it defaults to 10s.
+	ExpiryDelta time.Duration
+
+	// Client is used for requesting the tokens, if nil
+	// it defaults to a client with a 30s timeout.
+	Client Provider
+}
+
+// NewOAuth2Middleware returns a middleware that authenticates requests
+// with an access token obtained from the configured token endpoint.
+//
+// Tokens are cached until shortly before they expire, and concurrent
+// requests share a single token request. If a request is rejected with
+// a 401 status the token is invalidated and the request is retried once,
+// unless its body is an io.Reader that can't be sent twice.
+func NewOAuth2Middleware(config OAuth2Config) Middleware {
+	source := newOAuth2TokenSource(config, time.Now)
+
+	return func(
+		ctx context.Context,
+		method string,
+		url string,
+		data RequestData,
+		next NextMiddleware,
+	) (Response, error) {
+		token, err := source.Token(ctx)
+		if err != nil {
+			return Response{}, err
+		}
+
+		resp, err := next(ctx, method, url, withBearerToken(data, token))
+		if resp.StatusCode != http.StatusUnauthorized || !isReplayableBody(data.Body) {
+			return resp, err
+		}
+
+		source.Invalidate(token)
+		token, err = source.Token(ctx)
+		if err != nil {
+			return Response{}, err
+		}
+
+		return next(ctx, method, url, withBearerToken(data, token))
+	}
+}
+
+func withBearerToken(data RequestData, token string) RequestData {
+	data.Headers = copyHeaders(data.Headers)
+	setHeader(data.Headers, "Authorization", "Bearer "+token)
+	return data
+}
+
+func isReplayableBody(body any) bool {
+	switch body := body.(type) {
+	case map[string]io.Reader:
+		return isReplayableForm(multipartFormFromMap(body))
+	case MultipartForm:
+		return isReplayableForm(body)
+	case io.Reader:
+		return false
+	}
+	return true
+}
+
+type oauth2TokenSource struct {
+	config OAuth2Config
+	now    func() time.Time
+
+	mutex        sync.Mutex
+	accessToken  string
+	refreshToken string
+	expiresAt    time.Time
+	fetching     *inflightToken
+}
+
+type inflightToken struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+func newOAuth2TokenSource(config OAuth2Config, now func() time.Time) *oauth2TokenSource {
+	if config.GrantType == "" {
+		config.GrantType = OAuth2ClientCredentials
+	}
+	if config.ExpiryDelta == 0 {
+		config.ExpiryDelta = 10 * time.Second
+	}
+	if config.Client == nil {
+		config.Client = New(30 * time.Second)
+	}
+
+	return &oauth2TokenSource{
+		config:       config,
+		now:          now,
+		refreshToken: config.RefreshToken,
+	}
+}
+
+// Token returns the cached token if it is still valid
+// or fetches a new one from the token endpoint.
+func (s *oauth2TokenSource) Token(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	if s.accessToken != "" && (s.expiresAt.IsZero() || s.now().Before(s.expiresAt)) {
+		token := s.accessToken
+		s.mutex.Unlock()
+		return token, nil
+	}
+
+	fetching := s.fetching
+	isLeader := fetching == nil
+	if isLeader {
+		fetching = &inflightToken{
+			done: make(chan struct{}),
+		}
+		s.fetching = fetching
+	}
+	s.mutex.Unlock()
+
+	if !isLeader {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-fetching.done:
+			return fetching.token, fetching.err
+		}
+	}
+
+	fetching.token, fetching.err = s.fetchToken(ctx)
+
+	s.mutex.Lock()
+	s.fetching = nil
+	s.mutex.Unlock()
+	close(fetching.done)
+
+	return fetching.token, fetching.err
+}
+
+// Invalidate discards the cached token if it matches the input token,
+// forcing the next call to Token() to fetch a new one.
+func (s *oauth2TokenSource) Invalidate(token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.accessToken == token {
+		s.accessToken = ""
+	}
+}
+
+func (s *oauth2TokenSource) fetchToken(ctx context.Context) (string, error) {
+	params := url.Values{}
+	for k, v := range s.config.ExtraParams {
+		params[k] = v
+	}
+	params.Set("grant_type", s.config.GrantType)
+	if len(s.config.Scopes) > 0 {
+		params.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+
+	switch s.config.GrantType {
+	case OAuth2RefreshToken:
+		s.mutex.Lock()
+		params.Set("refresh_token", s.refreshToken)
+		s.mutex.Unlock()
+	case OAuth2JWTBearer:
+		if s.config.Assertion == nil {
+			return "", fmt.Errorf("the Assertion option is required for the %s grant type", OAuth2JWTBearer)
+		}
+		assertion, err := s.config.Assertion(ctx)
+		if err != nil {
+			return "", fmt.Errorf("error building oauth2 assertion: %w", err)
+		}
+		params.Set("assertion", assertion)
+	}
+
+	headers := map[string]any{
+		"Accept": "application/json",
+	}
+	if s.config.ClientID != "" {
+		if s.config.AuthInBody {
+			params.Set("client_id", s.config.ClientID)
+			params.Set("client_secret", s.config.ClientSecret)
+		} else {
+			req := http.Request{Header: http.Header{}}
+			req.SetBasicAuth(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret))
+			headers["Authorization"] = req.Header.Get("Authorization")
+		}
+	}
+
+	requestTime := s.now()
+	resp, err := s.config.Client.Post(ctx, s.config.TokenURL, RequestData{
+		Headers: headers,
+		Body:    params,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error fetching oauth2 token: %w", err)
+	}
+
+	var parsedResp struct {
+		AccessToken  string `json:"access_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	err = json.Unmarshal(resp.Body, &parsedResp)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse oauth2 token response as JSON: %w", err)
+	}
+	if parsedResp.AccessToken == "" {
+		return "", fmt.Errorf("oauth2 token response is missing the access_token: %s", string(resp.Body))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.accessToken = parsedResp.AccessToken
+	if parsedResp.RefreshToken != "" {
+		s.refreshToken = parsedResp.RefreshToken
+	}
+
+	// Tokens without `expires_in` are cached until they are rejected:
+	s.expiresAt = time.Time{}
+	if parsedResp.ExpiresIn > 0 {
+		s.expiresAt = requestTime.Add(time.Duration(parsedResp.ExpiresIn)*time.Second - s.config.ExpiryDelta)
+	}
+
+	return parsedResp.AccessToken, nil
+}
@@ -0,0 +1,211 @@
+package krest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestOAuth2Middleware(t *testing.T) {
+	ctx := context.Background()
+
+	newTokenServer := func(t *testing.T, expiresIn int, forms *[]url.Values) (*httptest.Server, *int32) {
+		var numTokens int32
+		var mutex sync.Mutex
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tt.AssertNoErr(t, r.ParseForm())
+
+			mutex.Lock()
+			if forms != nil {
+				*forms = append(*forms, r.PostForm)
+			}
+			mutex.Unlock()
+
+			clientID, clientSecret, _ := r.BasicAuth()
+			if r.PostForm.Get("client_id") != "" {
+				clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+			}
+			if clientID != "fakeClientID" || clientSecret != "fakeClientSecret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			n := atomic.AddInt32(&numTokens, 1)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"access_token":  fmt.Sprint("token", n),
+				"token_type":    "Bearer",
+				"expires_in":    expiresIn,
+				"refresh_token": fmt.Sprint("refresh", n),
+			})
+		}))
+		return svr, &numTokens
+	}
+
+	t.Run("should fetch a token and reuse it while it is valid", func(t *testing.T) {
+		var forms []url.Values
+		tokenSvr, numTokens := newTokenServer(t, 3600, &forms)
+		defer tokenSvr.Close()
+
+		var authHeaders []string
+		var mutex sync.Mutex
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+			mutex.Unlock()
+		}))
+		defer svr.Close()
+
+		client := New(time.Second, NewOAuth2Middleware(OAuth2Config{
+			TokenURL:     tokenSvr.URL,
+			ClientID:     "fakeClientID",
+			ClientSecret: "fakeClientSecret",
+			Scopes:       []string{"read", "write"},
+		}))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := client.Get(ctx, svr.URL, RequestData{})
+				tt.AssertNoErr(t, err)
+			}()
+		}
+		wg.Wait()
+
+		tt.AssertEqual(t, atomic.LoadInt32(numTokens), int32(1))
+		tt.AssertEqual(t, authHeaders, []string{
+			"Bearer token1", "Bearer token1", "Bearer token1", "Bearer token1", "Bearer token1",
+		})
+		tt.AssertEqual(t, forms[0].Get("grant_type"), "client_credentials")
+		tt.AssertEqual(t, forms[0].Get("scope"), "read write")
+	})
+
+	t.Run("should refresh the token shortly before it expires", func(t *testing.T) {
+		tokenSvr, numTokens := newTokenServer(t, 60, nil)
+		defer tokenSvr.Close()
+
+		now := time.Now()
+		source := newOAuth2TokenSource(OAuth2Config{
+			TokenURL:     tokenSvr.URL,
+			ClientID:     "fakeClientID",
+			ClientSecret: "fakeClientSecret",
+			AuthInBody:   true,
+		}, func() time.Time { return now })
+
+		token, err := source.Token(ctx)
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, token, "token1")
+
+		now = now.Add(45 * time.Second)
+		token, err = source.Token(ctx)
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, token, "token1")
+
+		// The default ExpiryDelta is 10s so it should refresh after 50s:
+		now = now.Add(6 * time.Second)
+		token, err = source.Token(ctx)
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, token, "token2")
+		tt.AssertEqual(t, atomic.LoadInt32(numTokens), int32(2))
+	})
+
+	t.Run("should invalidate the token and retry once on 401", func(t *testing.T) {
+		tokenSvr, numTokens := newTokenServer(t, 3600, nil)
+		defer tokenSvr.Close()
+
+		var authHeaders []string
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+			if r.Header.Get("Authorization") == "Bearer token1" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+		defer svr.Close()
+
+		client := New(time.Second, NewOAuth2Middleware(OAuth2Config{
+			TokenURL:     tokenSvr.URL,
+			ClientID:     "fakeClientID",
+			ClientSecret: "fakeClientSecret",
+		}))
+
+		resp, err := client.Post(ctx, svr.URL, RequestData{
+			Body: map[string]string{"fake": "body"},
+		})
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, resp.StatusCode, 200)
+		tt.AssertEqual(t, authHeaders, []string{"Bearer token1", "Bearer token2"})
+		tt.AssertEqual(t, atomic.LoadInt32(numTokens), int32(2))
+	})
+
+	t.Run("should use and rotate the refresh token", func(t *testing.T) {
+		var forms []url.Values
+		tokenSvr, _ := newTokenServer(t, 60, &forms)
+		defer tokenSvr.Close()
+
+		now := time.Now()
+		source := newOAuth2TokenSource(OAuth2Config{
+			TokenURL:     tokenSvr.URL,
+			ClientID:     "fakeClientID",
+			ClientSecret: "fakeClientSecret",
+			GrantType:    OAuth2RefreshToken,
+			RefreshToken: "initialRefreshToken",
+		}, func() time.Time { return now })
+
+		_, err := source.Token(ctx)
+		tt.AssertNoErr(t, err)
+
+		now = now.Add(time.Minute)
+		_, err = source.Token(ctx)
+		tt.AssertNoErr(t, err)
+
+		tt.AssertEqual(t, forms[0].Get("grant_type"), "refresh_token")
+		tt.AssertEqual(t, forms[0].Get("refresh_token"), "initialRefreshToken")
+		tt.AssertEqual(t, forms[1].Get("refresh_token"), "refresh1")
+	})
+
+	t.Run("should send the assertion for the jwt-bearer grant", func(t *testing.T) {
+		var forms []url.Values
+		tokenSvr, _ := newTokenServer(t, 60, &forms)
+		defer tokenSvr.Close()
+
+		source := newOAuth2TokenSource(OAuth2Config{
+			TokenURL:     tokenSvr.URL,
+			ClientID:     "fakeClientID",
+			ClientSecret: "fakeClientSecret",
+			GrantType:    OAuth2JWTBearer,
+			Assertion: func(ctx context.Context) (string, error) {
+				return "fakeSignedJWT", nil
+			},
+		}, time.Now)
+
+		_, err := source.Token(ctx)
+		tt.AssertNoErr(t, err)
+
+		tt.AssertEqual(t, forms[0].Get("grant_type"), OAuth2JWTBearer)
+		tt.AssertEqual(t, forms[0].Get("assertion"), "fakeSignedJWT")
+	})
+
+	t.Run("should report errors from the token endpoint", func(t *testing.T) {
+		tokenSvr, _ := newTokenServer(t, 60, nil)
+		defer tokenSvr.Close()
+
+		client := New(time.Second, NewOAuth2Middleware(OAuth2Config{
+			TokenURL:     tokenSvr.URL,
+			ClientID:     "fakeClientID",
+			ClientSecret: "wrongSecret",
+		}))
+
+		_, err := client.Get(ctx, "http://never.called", RequestData{})
+		tt.AssertErrContains(t, err, "oauth2", "401")
+	})
+}
@@ -0,0 +1,145 @@
+package krest
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem describes an RFC 9457 problem details object, it is parsed from
+// non-2xx responses with the `application/problem+json` content type and
+// can be retrieved from the returned error using errors.As:
+//
+//	var problem krest.Problem
+//	if errors.As(err, &problem) {
+//		fmt.Println(problem.Title, problem.Detail)
+//	}
+type Problem struct {
+	// Type is a URI reference identifying the problem type,
+	// when omitted by the server it defaults to "about:blank"
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+
+	// Extensions contains any members other than the ones above
+	Extensions map[string]interface{}
+}
+
+// Error implements the error interface
+func (p Problem) Error() string {
+	switch {
+	case p.Title != "" && p.Detail != "":
+		return p.Title + ": " + p.Detail
+	case p.Title != "":
+		return p.Title
+	case p.Detail != "":
+		return p.Detail
+	default:
+		return "problem of type " + p.Type
+	}
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+//
+// As recommended by the RFC, members whose values have
+// an unexpected type are ignored instead of causing errors.
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var members map[string]json.RawMessage
+	err := json.Unmarshal(data, &members)
+	if err != nil {
+		return err
+	}
+
+	*p = Problem{
+		Type: "about:blank",
+	}
+	for key, value := range members {
+		switch key {
+		case "type":
+			var s string
+			if json.Unmarshal(value, &s) == nil {
+				p.Type = s
+			}
+		case "title":
+			_ = json.Unmarshal(value, &p.Title)
+		case "status":
+			_ = json.Unmarshal(value, &p.Status)
+		case "detail":
+			_ = json.Unmarshal(value, &p.Detail)
+		case "instance":
+			_ = json.Unmarshal(value, &p.Instance)
+		default:
+			var v interface{}
+			err := json.Unmarshal(value, &v)
+			if err != nil {
+				return err
+			}
+			if p.Extensions == nil {
+				p.Extensions = map[string]interface{}{}
+			}
+			p.Extensions[key] = v
+		}
+	}
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (p Problem) MarshalJSON() ([]byte, error) {
+	members := map[string]interface{}{}
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+
+	if p.Type != "" {
+		members["type"] = p.Type
+	}
+	if p.Title != "" {
+		members["title"] = p.Title
+	}
+	if p.Status != 0 {
+		members["status"] = p.Status
+	}
+	if p.Detail != "" {
+		members["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		members["instance"] = p.Instance
+	}
+
+	return json.Marshal(members)
+}
+
+// parseProblem returns ok=false if the content type is not
+// `application/problem+json` or if the body is not a valid JSON object.
+func parseProblem(contentType string, body []byte) (problem Problem, ok bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != problemContentType {
+		return Problem{}, false
+	}
+
+	err = json.Unmarshal(body, &problem)
+	if err != nil {
+		return Problem{}, false
+	}
+
+	return problem, true
+}
+
+func newStatusError(method string, url string, statusCode int, contentType string, body []byte) error {
+	if problem, ok := parseProblem(contentType, body); ok {
+		return fmt.Errorf(
+			"%s %s: unexpected status code: %d, problem: %w",
+			method, url, statusCode, problem,
+		)
+	}
+
+	return fmt.Errorf(
+		"%s %s: unexpected status code: %d, payload: %s",
+		method, url, statusCode, truncatePayload(body),
+	)
+}
@@ -0,0 +1,116 @@
+package krest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestProblemDetails(t *testing.T) {
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		desc        string
+		contentType string
+		body        string
+
+		expectProblem      bool
+		expectedProblem    Problem
+		expectErrToContain []string
+	}{
+		{
+			desc:        "should parse problem+json responses",
+			contentType: "application/problem+json; charset=utf-8",
+			body: `{
+				"type": "https://example.com/probs/out-of-credit",
+				"title": "You do not have enough credit.",
+				"status": 403,
+				"detail": "Your current balance is 30, but that costs 50.",
+				"instance": "/account/12345/msgs/abc",
+				"balance": 30,
+				"accounts": ["/account/12345", "/account/67890"]
+			}`,
+			expectProblem: true,
+			expectedProblem: Problem{
+				Type:     "https://example.com/probs/out-of-credit",
+				Title:    "You do not have enough credit.",
+				Status:   403,
+				Detail:   "Your current balance is 30, but that costs 50.",
+				Instance: "/account/12345/msgs/abc",
+				Extensions: map[string]interface{}{
+					"balance":  float64(30),
+					"accounts": []interface{}{"/account/12345", "/account/67890"},
+				},
+			},
+			expectErrToContain: []string{
+				"GET", "403",
+				"You do not have enough credit.: Your current balance is 30, but that costs 50.",
+			},
+		},
+		{
+			desc:          "should default the type to about:blank and ignore invalid members",
+			contentType:   "application/problem+json",
+			body:          `{"title": "Not Found", "status": "404"}`,
+			expectProblem: true,
+			expectedProblem: Problem{
+				Type:  "about:blank",
+				Title: "Not Found",
+			},
+			expectErrToContain: []string{"403", "problem: Not Found"},
+		},
+		{
+			desc:               "should keep the raw payload for other content types",
+			contentType:        "application/json",
+			body:               `{"title": "Not Found"}`,
+			expectErrToContain: []string{"403", `payload: {"title": "Not Found"}`},
+		},
+		{
+			desc:               "should keep the raw payload for invalid problem+json bodies",
+			contentType:        "application/problem+json",
+			body:               `not json`,
+			expectErrToContain: []string{"403", "payload: not json"},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", test.contentType)
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = fmt.Fprint(w, test.body)
+			}))
+			defer svr.Close()
+
+			client := New(time.Second)
+			resp, err := client.Get(ctx, svr.URL, RequestData{})
+			tt.AssertErrContains(t, err, test.expectErrToContain...)
+			tt.AssertEqual(t, resp.StatusCode, 403)
+			tt.AssertEqual(t, string(resp.Body), test.body)
+
+			var problem Problem
+			tt.AssertEqual(t, errors.As(err, &problem), test.expectProblem)
+			if test.expectProblem {
+				tt.AssertEqual(t, problem, test.expectedProblem)
+			}
+		})
+	}
+
+	t.Run("should marshal the extension members at the top level", func(t *testing.T) {
+		problem := Problem{
+			Type:   "about:blank",
+			Title:  "Not Found",
+			Status: 404,
+			Extensions: map[string]interface{}{
+				"traceId": "fakeTraceID",
+			},
+		}
+
+		data, err := problem.MarshalJSON()
+		tt.AssertNoErr(t, err)
+		tt.AssertEqual(t, string(data), `{"status":404,"title":"Not Found","traceId":"fakeTraceID","type":"about:blank"}`)
+	})
+}
@@ -0,0 +1,55 @@
+package krest
+
+import (
+	"io"
+	"time"
+)
+
+// ProgressFunc receives the number of bytes transferred so far and the
+// total size of the body, which is -1 if the `Content-Length` is unknown.
+type ProgressFunc func(transferred int64, total int64)
+
+// progressInterval is the minimum interval between two calls
+// to a ProgressFunc, except for the last one which is always made.
+var progressInterval = 100 * time.Millisecond
+
+// progressReadCloser reports the progress of the reads to a ProgressFunc,
+// throttling the calls so they can be used for updating progress bars.
+type progressReadCloser struct {
+	io.ReadCloser
+
+	onProgress ProgressFunc
+	total      int64
+
+	transferred  int64
+	reported     int64
+	lastReportAt time.Time
+}
+
+func newProgressReadCloser(body io.ReadCloser, total int64, onProgress ProgressFunc) *progressReadCloser {
+	if total <= 0 {
+		total = -1
+	}
+
+	return &progressReadCloser{
+		ReadCloser:   body,
+		onProgress:   onProgress,
+		total:        total,
+		lastReportAt: time.Now(),
+	}
+}
+
+// Read implements the io.Reader interface
+func (p *progressReadCloser) Read(b []byte) (int, error) {
+	n, err := p.ReadCloser.Read(b)
+	p.transferred += int64(n)
+
+	finished := err == io.EOF || p.transferred == p.total
+	if p.transferred != p.reported && (finished || time.Since(p.lastReportAt) >= progressInterval) {
+		p.reported = p.transferred
+		p.lastReportAt = time.Now()
+		p.onProgress(p.transferred, p.total)
+	}
+
+	return n, err
+}
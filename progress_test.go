@@ -0,0 +1,205 @@
+package krest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestProgress(t *testing.T) {
+	ctx := context.Background()
+
+	defer func() {
+		progressInterval = 100 * time.Millisecond
+	}()
+
+	payload := strings.Repeat("0123456789", 10000)
+
+	type report struct {
+		transferred int64
+		total       int64
+	}
+
+	newRecorder := func() (ProgressFunc, func() []report) {
+		var mu sync.Mutex
+		var reports []report
+		return func(transferred int64, total int64) {
+				mu.Lock()
+				defer mu.Unlock()
+				reports = append(reports, report{transferred, total})
+			}, func() []report {
+				mu.Lock()
+				defer mu.Unlock()
+				return reports
+			}
+	}
+
+	assertProgress := func(t *testing.T, reports []report, expectedTotal int64) {
+		tt.AssertNotEqual(t, len(reports), 0)
+		for i, r := range reports {
+			tt.AssertEqual(t, r.total, expectedTotal)
+			if i > 0 {
+				tt.AssertEqual(t, r.transferred > reports[i-1].transferred, true)
+			}
+		}
+		tt.AssertEqual(t, reports[len(reports)-1].transferred, int64(len(payload)))
+	}
+
+	t.Run("should report the upload progress", func(t *testing.T) {
+		for _, test := range []struct {
+			desc          string
+			body          interface{}
+			expectedTotal int64
+		}{
+			{
+				desc:          "with a known Content-Length",
+				body:          payload,
+				expectedTotal: int64(len(payload)),
+			},
+			{
+				desc:          "with an unknown Content-Length",
+				body:          io.MultiReader(strings.NewReader(payload)),
+				expectedTotal: -1,
+			},
+		} {
+			t.Run(test.desc, func(t *testing.T) {
+				progressInterval = 0
+
+				svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					_, _ = io.ReadAll(r.Body)
+				}))
+				defer svr.Close()
+
+				onProgress, reports := newRecorder()
+
+				client := New(time.Second)
+				_, err := client.Post(ctx, svr.URL, RequestData{
+					Body:       test.body,
+					OnProgress: onProgress,
+				})
+				tt.AssertNoErr(t, err)
+
+				assertProgress(t, reports(), test.expectedTotal)
+			})
+		}
+	})
+
+	t.Run("should report the download progress", func(t *testing.T) {
+		for _, test := range []struct {
+			desc   string
+			stream bool
+		}{
+			{
+				desc: "buffered response",
+			},
+			{
+				desc:   "stream response",
+				stream: true,
+			},
+		} {
+			t.Run(test.desc, func(t *testing.T) {
+				progressInterval = 0
+
+				svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+					_, _ = io.WriteString(w, payload)
+				}))
+				defer svr.Close()
+
+				onProgress, reports := newRecorder()
+
+				client := New(time.Second)
+				resp, err := client.Get(ctx, svr.URL, RequestData{
+					Stream:     test.stream,
+					OnProgress: onProgress,
+				})
+				tt.AssertNoErr(t, err)
+
+				if test.stream {
+					_, err = io.ReadAll(resp)
+					tt.AssertNoErr(t, err)
+					tt.AssertNoErr(t, resp.Close())
+				}
+
+				assertProgress(t, reports(), int64(len(payload)))
+			})
+		}
+	})
+
+	t.Run("should report the upload and then the download progress", func(t *testing.T) {
+		progressInterval = time.Hour
+
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.ReadAll(r.Body)
+			w.Header().Set("Content-Length", "5")
+			_, _ = io.WriteString(w, "fakeR")
+		}))
+		defer svr.Close()
+
+		onProgress, reports := newRecorder()
+
+		client := New(time.Second)
+		_, err := client.Post(ctx, svr.URL, RequestData{
+			Body:       payload,
+			OnProgress: onProgress,
+		})
+		tt.AssertNoErr(t, err)
+
+		tt.AssertEqual(t, reports(), []report{
+			{transferred: int64(len(payload)), total: int64(len(payload))},
+			{transferred: 5, total: 5},
+		})
+	})
+
+	t.Run("should send empty bodies with a Content-Length of 0", func(t *testing.T) {
+		var contentLength int64
+		var transferEncoding []string
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentLength = r.ContentLength
+			transferEncoding = r.TransferEncoding
+		}))
+		defer svr.Close()
+
+		onProgress, reports := newRecorder()
+
+		client := New(time.Second)
+		_, err := client.Post(ctx, svr.URL, RequestData{
+			Body:       []byte{},
+			OnProgress: onProgress,
+		})
+		tt.AssertNoErr(t, err)
+
+		tt.AssertEqual(t, contentLength, int64(0))
+		tt.AssertEqual(t, len(transferEncoding), 0)
+		tt.AssertEqual(t, len(reports()), 0)
+	})
+
+	t.Run("should throttle the calls but always report the last one", func(t *testing.T) {
+		progressInterval = time.Hour
+
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, payload)
+		}))
+		defer svr.Close()
+
+		onProgress, reports := newRecorder()
+
+		client := New(time.Second)
+		_, err := client.Get(ctx, svr.URL, RequestData{
+			OnProgress: onProgress,
+		})
+		tt.AssertNoErr(t, err)
+
+		tt.AssertEqual(t, reports(), []report{
+			{transferred: int64(len(payload)), total: -1},
+		})
+	})
+}
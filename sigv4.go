@@ -0,0 +1,256 @@
+package krest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SigV4Config describes the credentials and scope used
+// for signing requests with AWS Signature Version 4.
+type SigV4Config struct {
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is only required when using temporary credentials
+	SessionToken string
+
+	Region  string
+	Service string
+
+	// UnsignedPayload disables the hashing of buffered bodies,
+	// bodies of type io.Reader are always sent unsigned.
+	UnsignedPayload bool
+}
+
+const (
+	sigV4Algorithm       = "AWS4-HMAC-SHA256"
+	sigV4UnsignedPayload = "UNSIGNED-PAYLOAD"
+	sigV4TimeFormat      = "20060102T150405Z"
+)
+
+// NewSigV4Middleware returns a middleware that signs requests using
+// AWS Signature Version 4, adding the `Authorization`, `X-Amz-Date` and
+// `X-Amz-Content-Sha256` headers to the request.
+//
+// Bodies that are streamed, i.e. of type io.Reader or multipart bodies,
+// are sent using the `UNSIGNED-PAYLOAD` mode since they can't be hashed
+// before being sent.
+func NewSigV4Middleware(config SigV4Config) Middleware {
+	return newSigV4Middleware(config, time.Now)
+}
+
+func newSigV4Middleware(config SigV4Config, now func() time.Time) Middleware {
+	return func(
+		ctx context.Context,
+		method string,
+		rawURL string,
+		data RequestData,
+		next NextMiddleware,
+	) (Response, error) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return Response{}, fmt.Errorf("unable to parse url for signing request: %w", err)
+		}
+
+		// Buffer the payload so we can be sure the signed
+		// payload is exactly the same as the one sent:
+		payload, ok, err := bufferBody(&data)
+		if err != nil {
+			return Response{}, err
+		}
+
+		payloadHash := sigV4UnsignedPayload
+		if ok {
+			payloadHash = hashSHA256Hex(payload)
+		}
+		if config.UnsignedPayload {
+			payloadHash = sigV4UnsignedPayload
+		}
+
+		t := now().UTC()
+		data.Headers = copyHeaders(data.Headers)
+		setHeader(data.Headers, "X-Amz-Date", t.Format(sigV4TimeFormat))
+		setHeader(data.Headers, "X-Amz-Content-Sha256", payloadHash)
+		if config.SessionToken != "" {
+			setHeader(data.Headers, "X-Amz-Security-Token", config.SessionToken)
+		}
+
+		headers := map[string]string{
+			"host": u.Host,
+		}
+		for k := range data.Headers {
+			name := strings.ToLower(k)
+			if name == "content-type" || name == "content-md5" || strings.HasPrefix(name, "x-amz-") {
+				headers[name] = getHeader(data.Headers, k)
+			}
+		}
+
+		setHeader(data.Headers, "Authorization", config.authorization(method, u, headers, payloadHash, t))
+
+		return next(ctx, method, rawURL, data)
+	}
+}
+
+// PresignURL generates a URL that can be used for making a request
+// without any extra credentials until it expires, which is the
+// standard way of sharing temporary access to S3 objects.
+func PresignURL(config SigV4Config, method string, rawURL string, expires time.Duration) (string, error) {
+	return presignURL(config, method, rawURL, expires, time.Now().UTC())
+}
+
+func presignURL(config SigV4Config, method string, rawURL string, expires time.Duration, t time.Time) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse url for presigning: %w", err)
+	}
+
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", config.AccessKeyID+"/"+config.scope(t))
+	query.Set("X-Amz-Date", t.Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if config.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", config.SessionToken)
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	headers := map[string]string{
+		"host": u.Host,
+	}
+	signature := config.signature(method, u, headers, sigV4UnsignedPayload, t)
+
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+func (c SigV4Config) authorization(
+	method string,
+	u *url.URL,
+	headers map[string]string,
+	payloadHash string,
+	t time.Time,
+) string {
+	return fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm,
+		c.AccessKeyID,
+		c.scope(t),
+		signedHeaders(headers),
+		c.signature(method, u, headers, payloadHash, t),
+	)
+}
+
+func (c SigV4Config) signature(
+	method string,
+	u *url.URL,
+	headers map[string]string,
+	payloadHash string,
+	t time.Time,
+) string {
+	canonicalRequest := strings.Join([]string{
+		strings.ToUpper(method),
+		c.canonicalURI(u),
+		canonicalQuery(u.Query()),
+		canonicalHeaders(headers),
+		signedHeaders(headers),
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		t.Format(sigV4TimeFormat),
+		c.scope(t),
+		hashSHA256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), []byte(t.Format("20060102")))
+	key = hmacSHA256(key, []byte(c.Region))
+	key = hmacSHA256(key, []byte(c.Service))
+	key = hmacSHA256(key, []byte("aws4_request"))
+
+	return hex.EncodeToString(hmacSHA256(key, []byte(stringToSign)))
+}
+
+func (c SigV4Config) scope(t time.Time) string {
+	return strings.Join([]string{t.Format("20060102"), c.Region, c.Service, "aws4_request"}, "/")
+}
+
+func (c SigV4Config) canonicalURI(u *url.URL) string {
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	path = sigV4Escape(path, false)
+	if c.Service != "s3" {
+		// All services except S3 expect the path to be encoded twice:
+		path = sigV4Escape(path, false)
+	}
+	return path
+}
+
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for key, values := range query {
+		for _, value := range values {
+			params = append(params, sigV4Escape(key, true)+"="+sigV4Escape(value, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+func canonicalHeaders(headers map[string]string) string {
+	var lines []string
+	for name, value := range headers {
+		lines = append(lines, name+":"+strings.Join(strings.Fields(value), " ")+"\n")
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "")
+}
+
+func signedHeaders(headers map[string]string) string {
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ";")
+}
+
+// sigV4Escape encodes every byte except the unreserved
+// characters as described on the AWS SigV4 documentation.
+func sigV4Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		isUnreserved := (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~'
+		if isUnreserved || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hashSHA256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,313 @@
+package krest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSSERetry is the reconnection delay used by client.SubscribeEvents()
+// until the server sends a different one with the `retry` field.
+const defaultSSERetry = 3 * time.Second
+
+// Event describes a single Server-Sent Event
+type Event struct {
+	// ID is the last event ID received on the stream,
+	// which is kept across events as defined by the spec
+	ID string
+
+	// Event is the event type, it defaults to "message"
+	Event string
+
+	// Data contains the data fields of the event joined by "\n"
+	Data string
+
+	// Retry is the reconnection delay sent along with this event, if any
+	Retry time.Duration
+}
+
+// EventStream delivers the events parsed from a `text/event-stream`
+// response, see resp.Events() and client.SubscribeEvents() for details.
+type EventStream struct {
+	events chan Event
+	err    error
+}
+
+// Events returns the channel where the events are delivered,
+// it is closed when the stream ends or the context is canceled.
+func (s *EventStream) Events() <-chan Event {
+	return s.events
+}
+
+// Err returns the error that ended the stream, if any, it should only
+// be called after the channel returned by Events() is closed.
+func (s *EventStream) Err() error {
+	return s.err
+}
+
+// Events parses the response body as a `text/event-stream`, the body
+// is closed when the stream ends or when the context is canceled.
+//
+// This function doesn't reconnect when the stream ends,
+// for that use client.SubscribeEvents() instead.
+func (r Response) Events(ctx context.Context) *EventStream {
+	stream := &EventStream{
+		events: make(chan Event),
+	}
+
+	// Closing the body on cancellation unblocks the reads
+	// that are waiting for the server to send new events:
+	body := newStreamBody(ctx, r.ReadCloser)
+
+	go func() {
+		defer close(stream.events)
+		defer body.Close()
+
+		err := deliverEvents(ctx, newEventParser(body), stream.events)
+		if ctx.Err() != nil {
+			stream.err = ctx.Err()
+		} else if err != io.EOF {
+			stream.err = fmt.Errorf("error reading event stream: %w", err)
+		}
+	}()
+
+	return stream
+}
+
+// SubscribeEvents makes a GET request to a `text/event-stream` endpoint
+// and delivers the events it receives, reconnecting through the middleware
+// chain with the `Last-Event-ID` header whenever the connection is lost.
+//
+// The reconnection delay defaults to 3s and can be changed by the server
+// using the `retry` field. The stream only ends when the context is canceled,
+// when the server responds with 204 No Content, or with an error if it
+// responds with any other status not in the range 200-299 or with a
+// Content-Type other than `text/event-stream`.
+//
+// Note that the client timeout also limits the duration of each connection,
+// so for long-lived streams prefer a client created with a timeout of 0.
+func (c Client) SubscribeEvents(ctx context.Context, url string, data RequestData) *EventStream {
+	stream := &EventStream{
+		events: make(chan Event),
+	}
+
+	go func() {
+		defer close(stream.events)
+
+		data.Stream = true
+		data.Headers = copyHeaders(data.Headers)
+		setHeader(data.Headers, "Accept", "text/event-stream")
+		setHeader(data.Headers, "Cache-Control", "no-cache")
+
+		var lastEventID string
+		retry := defaultSSERetry
+		for {
+			if lastEventID != "" {
+				setHeader(data.Headers, "Last-Event-ID", lastEventID)
+			}
+
+			resp, err := c.makeRequestWithMiddlewares(ctx, "GET", url, data)
+			if err == nil {
+				err = checkEventStreamResponse(resp)
+				if err != nil {
+					_ = resp.Close()
+				}
+			}
+			if err != nil && (resp.StatusCode != 0 || ctx.Err() != nil) {
+				stream.err = err
+				return
+			}
+
+			if err == nil {
+				if resp.StatusCode == http.StatusNoContent {
+					_ = resp.Close()
+					return
+				}
+
+				parser := newEventParser(resp)
+				parser.lastEventID = lastEventID
+				err = deliverEvents(ctx, parser, stream.events)
+				_ = resp.Close()
+
+				lastEventID = parser.lastEventID
+				if parser.retry != 0 {
+					retry = parser.retry
+				}
+			}
+
+			if ctx.Err() != nil {
+				stream.err = ctx.Err()
+				return
+			}
+
+			select {
+			case <-time.After(retry):
+			case <-ctx.Done():
+				stream.err = ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return stream
+}
+
+func checkEventStreamResponse(resp Response) error {
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Headers.Get("Content-Type"))
+	if mediaType != "text/event-stream" {
+		return fmt.Errorf(
+			"unexpected Content-Type for event stream: '%s'",
+			resp.Headers.Get("Content-Type"),
+		)
+	}
+
+	return nil
+}
+
+func deliverEvents(ctx context.Context, parser *eventParser, events chan<- Event) error {
+	for {
+		event, err := parser.next()
+		if err != nil {
+			return err
+		}
+
+		select {
+		case events <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// eventParser parses the `text/event-stream` format as described on:
+//
+// https://html.spec.whatwg.org/multipage/server-sent-events.html
+type eventParser struct {
+	reader *bufio.Reader
+
+	// pending contains the lines already read from
+	// chunks that used CR as line terminators
+	pending []string
+	started bool
+
+	lastEventID string
+	retry       time.Duration
+}
+
+func newEventParser(r io.Reader) *eventParser {
+	return &eventParser{
+		reader: bufio.NewReader(r),
+	}
+}
+
+// next returns the next event of the stream, or io.EOF when it ends,
+// incomplete events at the end of the stream are discarded.
+func (p *eventParser) next() (Event, error) {
+	var eventType string
+	var data strings.Builder
+	var hasData bool
+	var retry time.Duration
+
+	for {
+		line, err := p.readLine()
+		if err != nil {
+			return Event{}, err
+		}
+
+		if line == "" {
+			if !hasData {
+				// Blocks without data reset the event type without dispatching:
+				eventType = ""
+				retry = 0
+				continue
+			}
+
+			if eventType == "" {
+				eventType = "message"
+			}
+			return Event{
+				ID:    p.lastEventID,
+				Event: eventType,
+				Data:  strings.TrimSuffix(data.String(), "\n"),
+				Retry: retry,
+			}, nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			// Comments are ignored:
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteString("\n")
+			hasData = true
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				p.lastEventID = value
+			}
+		case "retry":
+			ms, err := strconv.ParseUint(value, 10, 63)
+			if err == nil {
+				retry = time.Duration(ms) * time.Millisecond
+				p.retry = retry
+			}
+		}
+	}
+}
+
+// readLine returns the next line without its terminator,
+// which can be either CRLF, LF or CR.
+//
+// Note that lines terminated by CR are only returned once a LF
+// or the end of the stream is received, since it reads up to LF.
+func (p *eventParser) readLine() (string, error) {
+	if len(p.pending) > 0 {
+		line := p.pending[0]
+		p.pending = p.pending[1:]
+		return line, nil
+	}
+
+	line, err := p.reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		// Lines without terminators at the end of the stream are discarded,
+		// unless they are terminated by CR:
+		if !strings.HasSuffix(line, "\r") {
+			return "", io.EOF
+		}
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !p.started {
+		p.started = true
+		line = strings.TrimPrefix(line, "\uFEFF")
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+
+	lines := strings.Split(line, "\r")
+	p.pending = lines[1:]
+	return lines[0], nil
+}
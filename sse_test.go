@@ -0,0 +1,266 @@
+package krest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tt "github.com/vingarcia/krest/internal/testtools"
+)
+
+func TestEventParser(t *testing.T) {
+	for _, test := range []struct {
+		desc           string
+		stream         string
+		expectedEvents []Event
+	}{
+		{
+			desc:   "should parse simple events",
+			stream: "data: first\n\ndata: second\n\n",
+			expectedEvents: []Event{
+				{Event: "message", Data: "first"},
+				{Event: "message", Data: "second"},
+			},
+		},
+		{
+			desc:   "should join multi-line data",
+			stream: "data: line1\ndata:line2\ndata\n\n",
+			expectedEvents: []Event{
+				{Event: "message", Data: "line1\nline2\n"},
+			},
+		},
+		{
+			desc:   "should parse all the fields and ignore comments",
+			stream: ": this is a comment\nevent: update\nid: 42\nretry: 1500\nunknown: field\ndata: {}\n\n",
+			expectedEvents: []Event{
+				{ID: "42", Event: "update", Data: "{}", Retry: 1500 * time.Millisecond},
+			},
+		},
+		{
+			desc:   "should keep the last event ID across events",
+			stream: "id: 1\ndata: a\n\ndata: b\n\nid\ndata: c\n\n",
+			expectedEvents: []Event{
+				{ID: "1", Event: "message", Data: "a"},
+				{ID: "1", Event: "message", Data: "b"},
+				{ID: "", Event: "message", Data: "c"},
+			},
+		},
+		{
+			desc:   "should not dispatch blocks without data",
+			stream: "event: ignored\n\ndata: a\n\n",
+			expectedEvents: []Event{
+				{Event: "message", Data: "a"},
+			},
+		},
+		{
+			desc:   "should accept CRLF and CR line terminators",
+			stream: "\uFEFFdata: a\r\n\r\ndata: b\r\rdata: c\r\r\n",
+			expectedEvents: []Event{
+				{Event: "message", Data: "a"},
+				{Event: "message", Data: "b"},
+				{Event: "message", Data: "c"},
+			},
+		},
+		{
+			desc:   "should discard incomplete events at the end of the stream",
+			stream: "data: a\n\ndata: incomplete\n",
+			expectedEvents: []Event{
+				{Event: "message", Data: "a"},
+			},
+		},
+		{
+			desc:   "should ignore invalid retry values",
+			stream: "retry: 1s\ndata: a\n\n",
+			expectedEvents: []Event{
+				{Event: "message", Data: "a"},
+			},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			parser := newEventParser(strings.NewReader(test.stream))
+
+			var events []Event
+			for {
+				event, err := parser.next()
+				if err == io.EOF {
+					break
+				}
+				tt.AssertNoErr(t, err)
+				events = append(events, event)
+			}
+
+			tt.AssertEqual(t, events, test.expectedEvents)
+		})
+	}
+}
+
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should read events from a stream response", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprint(w, "event: a\ndata: 1\n\nevent: b\ndata: 2\n\n")
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		resp, err := client.Get(ctx, svr.URL, RequestData{
+			Stream: true,
+		})
+		tt.AssertNoErr(t, err)
+
+		stream := resp.Events(ctx)
+
+		var events []Event
+		for event := range stream.Events() {
+			events = append(events, event)
+		}
+		tt.AssertNoErr(t, stream.Err())
+		tt.AssertEqual(t, events, []Event{
+			{Event: "a", Data: "1"},
+			{Event: "b", Data: "2"},
+		})
+	})
+
+	t.Run("should stop when the context is canceled", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprint(w, "data: 1\n\n")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+		defer svr.Close()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		client := New(time.Second)
+		resp, err := client.Get(ctx, svr.URL, RequestData{
+			Stream: true,
+		})
+		tt.AssertNoErr(t, err)
+
+		stream := resp.Events(ctx)
+		event := <-stream.Events()
+		tt.AssertEqual(t, event.Data, "1")
+
+		cancel()
+		for range stream.Events() {
+		}
+		tt.AssertNotEqual(t, stream.Err(), nil)
+	})
+
+	t.Run("should stop when the context is canceled while waiting for events", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+		defer svr.Close()
+
+		// The request context is not canceled, so only
+		// the context passed to Events() can stop it:
+		client := New(0)
+		resp, err := client.Get(ctx, svr.URL, RequestData{
+			Stream: true,
+		})
+		tt.AssertNoErr(t, err)
+
+		eventsCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		stream := resp.Events(eventsCtx)
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		var closed bool
+		select {
+		case _, ok := <-stream.Events():
+			closed = !ok
+		case <-time.After(time.Second):
+		}
+		tt.AssertEqual(t, closed, true)
+		tt.AssertEqual(t, stream.Err(), context.Canceled)
+	})
+}
+
+func TestSubscribeEvents(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should reconnect with the Last-Event-ID header", func(t *testing.T) {
+		var connections int
+		var lastEventIDs []string
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			connections++
+			lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+			tt.AssertEqual(t, r.Header.Get("Accept"), "text/event-stream")
+
+			switch connections {
+			case 1:
+				w.Header().Set("Content-Type", "text/event-stream")
+				_, _ = fmt.Fprint(w, "retry: 10\nid: 1\ndata: first\n\n")
+			case 2:
+				w.Header().Set("Content-Type", "text/event-stream")
+				_, _ = fmt.Fprint(w, "id: 2\ndata: second\n\n")
+			default:
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+		defer svr.Close()
+
+		var middlewareCalls int
+		client := New(time.Second, func(
+			ctx context.Context, method string, url string, data RequestData, next NextMiddleware,
+		) (Response, error) {
+			middlewareCalls++
+			return next(ctx, method, url, data)
+		})
+
+		stream := client.SubscribeEvents(ctx, svr.URL, RequestData{})
+
+		var events []Event
+		for event := range stream.Events() {
+			events = append(events, event)
+		}
+		tt.AssertNoErr(t, stream.Err())
+
+		tt.AssertEqual(t, events, []Event{
+			{ID: "1", Event: "message", Data: "first", Retry: 10 * time.Millisecond},
+			{ID: "2", Event: "message", Data: "second"},
+		})
+		tt.AssertEqual(t, lastEventIDs, []string{"", "1", "2"})
+		tt.AssertEqual(t, middlewareCalls, 3)
+	})
+
+	t.Run("should fail on error responses", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		stream := client.SubscribeEvents(ctx, svr.URL, RequestData{})
+		for range stream.Events() {
+		}
+		tt.AssertErrContains(t, stream.Err(), "401")
+	})
+
+	t.Run("should fail on unexpected content types", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprint(w, `{}`)
+		}))
+		defer svr.Close()
+
+		client := New(time.Second)
+		stream := client.SubscribeEvents(ctx, svr.URL, RequestData{})
+		for range stream.Events() {
+		}
+		tt.AssertErrContains(t, stream.Err(), "Content-Type", "application/json")
+	})
+}